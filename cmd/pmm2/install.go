@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/executor"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/policy"
+	"github.com/ehyland/pmm2/internal/resolver"
+	"github.com/spf13/cobra"
+)
+
+func newInstallCmd(conf *config.Config) *cobra.Command {
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "install [package-manager@version...]",
+		Short: "Install package manager versions without running them",
+		Long: `Install package manager versions into the store, e.g. to warm a Docker image or CI cache.
+
+With no arguments, installs the version the current project resolves to.
+Versions may be exact, ranges or dist-tags: pnpm@9.12.0 yarn@^1 npm@latest`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var specs []inspector.PackageManagerSpec
+			if len(args) == 0 {
+				spec, err := resolveProject(conf)
+				if err != nil {
+					return err
+				}
+				if spec == nil {
+					return fmt.Errorf("no package manager configured for this project; pass one, e.g. pmm install pnpm@latest")
+				}
+				specs = append(specs, *spec)
+			}
+
+			for _, arg := range args {
+				spec, err := inspector.ParseSpecString(arg)
+				if err != nil {
+					return err
+				}
+				resolved, err := resolver.Resolve(conf, spec)
+				if err != nil {
+					return err
+				}
+				specs = append(specs, *resolved)
+			}
+
+			for _, spec := range specs {
+				if err := policy.Enforce(conf, spec); err != nil {
+					return err
+				}
+			}
+			return installer.InstallAll(conf, specs, concurrency)
+		},
+	}
+
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "j", installer.DefaultConcurrency, "maximum number of parallel downloads")
+	return cmd
+}
+
+// resolveProject returns the version of the package manager configured for
+// the current project, or nil outside of one.
+func resolveProject(conf *config.Config) (*inspector.PackageManagerSpec, error) {
+	found, err := inspector.FindPackageManagerSpec(conf)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	return executor.ResolveSpec(conf, found.Spec.Name)
+}
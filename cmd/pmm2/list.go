@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/defaults"
+	"github.com/ehyland/pmm2/internal/executor"
+	"github.com/ehyland/pmm2/internal/humanize"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/spf13/cobra"
+)
+
+type listEntry struct {
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Path     string    `json:"path"`
+	Default  bool      `json:"default"`
+	Project  bool      `json:"project"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+func newListCmd(conf *config.Config) *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List installed package manager versions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, err := localProject(conf)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Could not resolve this project's package manager: %v\n", err)
+			}
+			if project != nil && project.Version == "" {
+				fmt.Fprintf(os.Stderr, "This project's %s version is unknown until it is resolved, e.g. by running %s.\n", project.Name, project.Name)
+			}
+
+			entries, err := listInstalled(conf, project)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+			return printList(cmd.OutOrStdout(), entries, time.Now())
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print machine-readable JSON")
+	return cmd
+}
+
+// localProject is the package manager version the current project runs, as
+// far as it can be told without the registry. It returns nil outside of a
+// project, and a spec without a version when the version is unknown.
+func localProject(conf *config.Config) (*inspector.PackageManagerSpec, error) {
+	found, err := inspector.FindPackageManagerSpec(conf)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	return executor.LocalSpec(conf, found.Spec.Name)
+}
+
+// listInstalled describes every installed version, marking the defaults and
+// project, the version the current project resolves to if any.
+func listInstalled(conf *config.Config, project *inspector.PackageManagerSpec) ([]listEntry, error) {
+	entries := []listEntry{}
+	for _, name := range config.GetSupportedPackageManagers() {
+		versions, err := installer.ListInstalled(conf, name)
+		if err != nil {
+			return nil, err
+		}
+		defaultVersion := defaults.ReadDefault(conf, name)
+
+		for _, version := range versions {
+			spec := inspector.PackageManagerSpec{Name: name, Version: version}
+			size, err := installer.DiskUsage(conf, spec)
+			if err != nil {
+				return nil, err
+			}
+			lastUsed, err := installer.LastUsed(conf, spec)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, listEntry{
+				Name:     name,
+				Version:  version,
+				Path:     installer.GetInstallPath(conf, spec),
+				Default:  version == defaultVersion,
+				Project:  project != nil && project.Name == name && project.Version == version,
+				Size:     size,
+				LastUsed: lastUsed,
+			})
+		}
+	}
+	return entries, nil
+}
+
+func printList(w io.Writer, entries []listEntry, now time.Time) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "No package manager versions installed.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tSIZE\tLAST USED\t")
+	for _, entry := range entries {
+		var marks []string
+		if entry.Default {
+			marks = append(marks, "default")
+		}
+		if entry.Project {
+			marks = append(marks, "project")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.Name, entry.Version, formatSize(entry.Size), formatAge(now.Sub(entry.LastUsed)), strings.Join(marks, ", "))
+	}
+	return tw.Flush()
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+func formatAge(age time.Duration) string {
+	if age < time.Minute {
+		return "just now"
+	}
+	return humanize.Duration(age) + " ago"
+}
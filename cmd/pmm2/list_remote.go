@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/registry"
+	"github.com/ehyland/pmm2/internal/resolver"
+	"github.com/spf13/cobra"
+)
+
+type remoteVersion struct {
+	Version    *semver.Version
+	Published  time.Time
+	Tags       []string
+	Installed  bool
+	Deprecated string
+}
+
+type remoteFilter struct {
+	Major    *uint64
+	TagsOnly bool
+	Since    time.Time
+}
+
+func newListRemoteCmd(conf *config.Config) *cobra.Command {
+	var major uint64
+	var tagsOnly bool
+	var since string
+
+	cmd := &cobra.Command{
+		Use:   "list-remote <package-manager>",
+		Short: "List versions published to the registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if !config.IsSupported(name) {
+				return fmt.Errorf("unsupported package manager: %s", name)
+			}
+			if name == "bun" {
+				return fmt.Errorf("bun is not published with release metadata; see https://github.com/oven-sh/bun/releases")
+			}
+
+			var filter remoteFilter
+			if cmd.Flags().Changed("major") {
+				filter.Major = &major
+			}
+			filter.TagsOnly = tagsOnly
+			if since != "" {
+				t, err := time.Parse(time.DateOnly, since)
+				if err != nil {
+					return fmt.Errorf("invalid --since date %q, expected YYYY-MM-DD", since)
+				}
+				filter.Since = t
+			}
+
+			packuments, err := resolver.GetFullPackuments(conf, name)
+			if err != nil {
+				return err
+			}
+			installed, err := installer.ListInstalled(conf, name)
+			if err != nil {
+				return err
+			}
+
+			versions := remoteVersions(name, packuments, installed)
+			return printRemote(cmd.OutOrStdout(), filterRemote(versions, filter))
+		},
+	}
+
+	cmd.Flags().Uint64Var(&major, "major", 0, "only show versions with this major version")
+	cmd.Flags().BoolVar(&tagsOnly, "tags", false, "only show versions a dist-tag points at")
+	cmd.Flags().StringVar(&since, "since", "", "only show versions published on or after this date (YYYY-MM-DD)")
+	return cmd
+}
+
+// remoteVersions lists every published version of name, oldest first.
+func remoteVersions(name string, packuments []*registry.Packument, installed []string) []remoteVersion {
+	tagsByVersion := map[string][]string{}
+	for tag, version := range resolver.DistTags(name, packuments) {
+		tagsByVersion[version] = append(tagsByVersion[version], tag)
+	}
+
+	var versions []remoteVersion
+	for _, packument := range packuments {
+		for v, manifest := range packument.Versions {
+			version, err := semver.NewVersion(v)
+			if err != nil {
+				continue
+			}
+			tags := tagsByVersion[v]
+			sort.Strings(tags)
+			versions = append(versions, remoteVersion{
+				Version:    version,
+				Published:  packument.Time[v],
+				Tags:       tags,
+				Installed:  slices.Contains(installed, v),
+				Deprecated: manifest.Deprecated,
+			})
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version.LessThan(versions[j].Version)
+	})
+	return versions
+}
+
+func filterRemote(versions []remoteVersion, filter remoteFilter) []remoteVersion {
+	var filtered []remoteVersion
+	for _, v := range versions {
+		if filter.Major != nil && v.Version.Major() != *filter.Major {
+			continue
+		}
+		if filter.TagsOnly && len(v.Tags) == 0 {
+			continue
+		}
+		if !filter.Since.IsZero() && v.Published.Before(filter.Since) {
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+	return filtered
+}
+
+func printRemote(w io.Writer, versions []remoteVersion) error {
+	if len(versions) == 0 {
+		_, err := fmt.Fprintln(w, "No matching versions.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tPUBLISHED\tTAGS\t")
+	for _, v := range versions {
+		published := "-"
+		if !v.Published.IsZero() {
+			published = v.Published.Format(time.DateOnly)
+		}
+		var notes []string
+		if v.Installed {
+			notes = append(notes, "installed")
+		}
+		if v.Deprecated != "" {
+			notes = append(notes, "deprecated: "+v.Deprecated)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Version.Original(), published, strings.Join(v.Tags, ", "), strings.Join(notes, "; "))
+	}
+	return tw.Flush()
+}
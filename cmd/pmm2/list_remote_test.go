@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+func day(d int) time.Time {
+	return time.Date(2025, 1, d, 12, 0, 0, 0, time.UTC)
+}
+
+var remotePackuments = []*registry.Packument{
+	{
+		DistTags: map[string]string{"latest": "1.22.22"},
+		Versions: map[string]registry.PackumentVersion{
+			"1.22.19": {Deprecated: "please upgrade"},
+			"1.22.22": {},
+		},
+		Time: map[string]time.Time{"1.22.19": day(1), "1.22.22": day(5)},
+	},
+	{
+		DistTags: map[string]string{"latest": "4.5.0", "canary": "4.6.0-rc.1"},
+		Versions: map[string]registry.PackumentVersion{
+			"3.8.7":      {},
+			"4.5.0":      {},
+			"4.6.0-rc.1": {},
+		},
+		Time: map[string]time.Time{"3.8.7": day(2), "4.5.0": day(10), "4.6.0-rc.1": day(20)},
+	},
+}
+
+func versionStrings(versions []remoteVersion) []string {
+	var out []string
+	for _, v := range versions {
+		out = append(out, v.Version.Original())
+	}
+	return out
+}
+
+func TestRemoteVersions(t *testing.T) {
+	versions := remoteVersions("yarn", remotePackuments, []string{"4.5.0"})
+
+	if got := strings.Join(versionStrings(versions), " "); got != "1.22.19 1.22.22 3.8.7 4.5.0 4.6.0-rc.1" {
+		t.Fatalf("unexpected versions %s", got)
+	}
+	for _, v := range versions {
+		switch v.Version.Original() {
+		case "1.22.19":
+			if v.Deprecated != "please upgrade" {
+				t.Errorf("expected 1.22.19 to be deprecated, got %+v", v)
+			}
+		case "1.22.22":
+			if strings.Join(v.Tags, ",") != "latest" {
+				t.Errorf("expected Classic latest tag, got %v", v.Tags)
+			}
+		case "4.5.0":
+			if !v.Installed || strings.Join(v.Tags, ",") != "stable" {
+				t.Errorf("expected installed 4.5.0 tagged stable, got %+v", v)
+			}
+		}
+	}
+}
+
+func TestFilterRemote(t *testing.T) {
+	versions := remoteVersions("yarn", remotePackuments, nil)
+	four := uint64(4)
+
+	tests := []struct {
+		name     string
+		filter   remoteFilter
+		expected string
+	}{
+		{"major", remoteFilter{Major: &four}, "4.5.0 4.6.0-rc.1"},
+		{"tags", remoteFilter{TagsOnly: true}, "1.22.22 4.5.0 4.6.0-rc.1"},
+		{"since", remoteFilter{Since: day(5)}, "1.22.22 4.5.0 4.6.0-rc.1"},
+		{"combined", remoteFilter{Major: &four, TagsOnly: true, Since: day(15)}, "4.6.0-rc.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(versionStrings(filterRemote(versions, tt.filter)), " "); got != tt.expected {
+				t.Errorf("filterRemote() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPrintRemote(t *testing.T) {
+	var out bytes.Buffer
+	if err := printRemote(&out, remoteVersions("yarn", remotePackuments, []string{"4.5.0"})); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2025-01-10", "stable", "installed", "deprecated: please upgrade", "canary"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/defaults"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+)
+
+func TestListInstalled(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	installertest.FakeInstall(t, conf, "pnpm", "8.15.9")
+	installertest.FakeInstall(t, conf, "pnpm", "9.12.0")
+	installertest.FakeInstall(t, conf, "npm", "10.8.0")
+	if err := defaults.UpdateDefault(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.12.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := listInstalled(conf, &inspector.PackageManagerSpec{Name: "pnpm", Version: "8.15.9"})
+	if err != nil {
+		t.Fatalf("listInstalled() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v", entries)
+	}
+
+	byVersion := map[string]listEntry{}
+	for _, entry := range entries {
+		byVersion[entry.Name+"@"+entry.Version] = entry
+	}
+	if e := byVersion["pnpm@9.12.0"]; !e.Default || e.Project {
+		t.Errorf("expected pnpm@9.12.0 to be the default only, got %+v", e)
+	}
+	if e := byVersion["pnpm@8.15.9"]; e.Default || !e.Project {
+		t.Errorf("expected pnpm@8.15.9 to be the project version only, got %+v", e)
+	}
+	if e := byVersion["npm@10.8.0"]; e.Default || e.Project || e.Size == 0 || e.LastUsed.IsZero() {
+		t.Errorf("unexpected npm@10.8.0 entry %+v", e)
+	}
+}
+
+func TestListCmd_ReadOnly(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	installertest.FakeInstall(t, conf, "pnpm", "9.12.0")
+	if err := defaults.UpdateDefault(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.12.0"}); err != nil {
+		t.Fatal(err)
+	}
+	// Installed by a pmm2 that predates the completion marker.
+	legacy := installer.GetInstallPath(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "8.15.9"})
+	if err := os.MkdirAll(filepath.Join(legacy, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(legacy, "package.json"), []byte(`{"bin": {"pnpm": "bin/pnpm.cjs"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(legacy, "bin", "pnpm.cjs"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "package.json"), []byte(`{"packageManager": "pnpm@^8"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	before := snapshotDir(t, conf.PmmDir)
+	var out bytes.Buffer
+	cmd := newListCmd(conf)
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("list error = %v", err)
+	}
+	if !strings.Contains(out.String(), "8.15.9") {
+		t.Errorf("expected the legacy install to be listed, got:\n%s", out.String())
+	}
+	if after := snapshotDir(t, conf.PmmDir); !reflect.DeepEqual(before, after) {
+		t.Errorf("expected list to leave the store unchanged\nbefore: %v\nafter:  %v", before, after)
+	}
+}
+
+// snapshotDir records every path under dir with its mode, mtime and
+// contents.
+func snapshotDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	snapshot := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := fmt.Sprintf("%v %v", info.Mode(), info.ModTime().UnixNano())
+		if d.Type().IsRegular() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			entry += " " + string(data)
+		}
+		snapshot[path] = entry
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot
+}
+
+func TestPrintList(t *testing.T) {
+	now := time.Now()
+	entries := []listEntry{
+		{Name: "pnpm", Version: "9.12.0", Default: true, Project: true, Size: 45 << 20, LastUsed: now.Add(-2 * time.Hour)},
+		{Name: "yarn", Version: "1.22.22", Size: 512, LastUsed: now.Add(-72 * time.Hour)},
+	}
+
+	var out bytes.Buffer
+	if err := printList(&out, entries, now); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got:\n%s", out.String())
+	}
+	for _, want := range []string{"pnpm", "9.12.0", "45.0 MB", "2 hours ago", "default, project"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("expected %q in %q", want, lines[1])
+		}
+	}
+	for _, want := range []string{"yarn", "512 B", "3 days ago"} {
+		if !strings.Contains(lines[2], want) {
+			t.Errorf("expected %q in %q", want, lines[2])
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := []struct {
+		age      time.Duration
+		expected string
+	}{
+		{10 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{5 * time.Hour, "5 hours ago"},
+		{30 * 24 * time.Hour, "30 days ago"},
+	}
+	for _, tt := range tests {
+		if got := formatAge(tt.age); got != tt.expected {
+			t.Errorf("formatAge(%v) = %q, want %q", tt.age, got, tt.expected)
+		}
+	}
+}
@@ -19,6 +19,7 @@ var (
 func main() {
 	exeName := filepath.Base(os.Args[0])
 	conf := config.LoadConfig()
+	conf.UserAgent = "pmm2/" + version
 
 	switch exeName {
 	case "npm", "pnpm", "yarn", "bun":
@@ -58,6 +59,11 @@ func main() {
 		newUpdateDefaultCmd(conf),
 		newUpdateSelfCmd(version),
 		newPinCmd(conf),
+		newInstallCmd(conf),
+		newListCmd(conf),
+		newListRemoteCmd(conf),
+		newUninstallCmd(conf),
+		newPruneCmd(conf),
 		newSetupCmd(conf),
 	)
 
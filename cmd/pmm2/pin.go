@@ -8,43 +8,94 @@ import (
 
 	"github.com/ehyland/pmm2/internal/config"
 	"github.com/ehyland/pmm2/internal/inspector"
-	"github.com/ehyland/pmm2/internal/registry"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/policy"
+	"github.com/ehyland/pmm2/internal/resolver"
 	"github.com/spf13/cobra"
 )
 
 func newPinCmd(conf *config.Config) *cobra.Command {
-	return &cobra.Command{
-		Use:   "pin <package-manager> <path-to-package>",
-		Short: "Write packageManager field to package.json",
-		Args:  cobra.ExactArgs(2),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			name := args[0]
-			path := args[1]
+	var withHash bool
 
-			if !config.IsSupported(name) {
-				return fmt.Errorf("unsupported package manager: %s", name)
-			}
+	cmd := &cobra.Command{
+		Use:   "pin <package-manager>[@version] [path-to-package]",
+		Short: "Write packageManager field to package.json",
+		Long: `Resolve a version, install it, and write it to the packageManager field.
 
-			absPath, err := filepath.Abs(path)
+The version may be exact, a range or a dist-tag (pnpm@8, yarn@1.22.22, npm@next)
+and defaults to latest. The path defaults to the current project.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			spec, err := parsePinSpec(args[0])
 			if err != nil {
 				return err
 			}
 
-			pkgJSONPath := absPath
-			if !strings.HasSuffix(absPath, "package.json") {
-				pkgJSONPath = filepath.Join(absPath, "package.json")
+			var pkgJSONPath string
+			if len(args) > 1 {
+				pkgJSONPath, err = packageJSONAt(args[1])
+			} else {
+				pkgJSONPath, err = inspector.FindProjectPackageJSON(conf)
 			}
-
-			if _, err := os.Stat(pkgJSONPath); err != nil {
-				return fmt.Errorf("package.json not found at %s", pkgJSONPath)
+			if err != nil {
+				return err
 			}
 
-			latest, err := registry.GetLatestVersion(conf, name)
+			resolved, err := resolver.ResolveMature(conf, spec)
 			if err != nil {
 				return err
 			}
+			if err := policy.Enforce(conf, *resolved); err != nil {
+				return err
+			}
+			if err := installer.Install(conf, *resolved); err != nil {
+				return err
+			}
+
+			if withHash {
+				hash, err := installer.CorepackSHA512(conf, *resolved)
+				if err != nil {
+					return err
+				}
+				resolved.HashAlgorithm = "sha512"
+				resolved.Hash = hash
+			}
 
-			return inspector.UpdateSpecInPackageJSON(pkgJSONPath, *latest)
+			fmt.Printf("Pinning %s to %s@%s\n", pkgJSONPath, resolved.Name, resolved.Version)
+			return inspector.UpdateSpecInPackageJSON(pkgJSONPath, *resolved)
 		},
 	}
+
+	cmd.Flags().BoolVar(&withHash, "hash", false, "also write the sha512 that corepack checks")
+	return cmd
+}
+
+// parsePinSpec accepts a bare package manager name, meaning its latest
+// version, or a full name@version spec.
+func parsePinSpec(arg string) (inspector.PackageManagerSpec, error) {
+	if strings.Contains(arg, "@") {
+		return inspector.ParseSpecString(arg)
+	}
+	if !config.IsSupported(arg) {
+		return inspector.PackageManagerSpec{}, fmt.Errorf("unsupported package manager: %s", arg)
+	}
+	return inspector.PackageManagerSpec{Name: arg, Version: "latest"}, nil
+}
+
+// packageJSONAt accepts either a package.json or the directory holding it.
+func packageJSONAt(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	pkgJSONPath := absPath
+	if !strings.HasSuffix(absPath, "package.json") {
+		pkgJSONPath = filepath.Join(absPath, "package.json")
+	}
+
+	if _, err := os.Stat(pkgJSONPath); err != nil {
+		return "", fmt.Errorf("package.json not found at %s", pkgJSONPath)
+	}
+	return pkgJSONPath, nil
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+	"github.com/ehyland/pmm2/internal/policy"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+func TestParsePinSpec(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected inspector.PackageManagerSpec
+		wantErr  bool
+	}{
+		{"pnpm", inspector.PackageManagerSpec{Name: "pnpm", Version: "latest"}, false},
+		{"pnpm@8", inspector.PackageManagerSpec{Name: "pnpm", Version: "8"}, false},
+		{"yarn@1.22.22", inspector.PackageManagerSpec{Name: "yarn", Version: "1.22.22"}, false},
+		{"npm@next", inspector.PackageManagerSpec{Name: "npm", Version: "next"}, false},
+		{"deno", inspector.PackageManagerSpec{}, true},
+		{"deno@1.0.0", inspector.PackageManagerSpec{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePinSpec(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePinSpec(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("parsePinSpec(%s) = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestPinCmd(t *testing.T) {
+	pnpmTarball := installertest.Tarball(t, installertest.PnpmFiles)
+	pnpmSum := sha512.Sum512(pnpmTarball)
+	server := installertest.NewRegistry(t, map[string]installertest.Package{
+		"pnpm": {DistTags: map[string]string{"latest": "9.1.0"}, Versions: []string{"8.15.8", "8.15.9", "9.1.0"}, Tarball: pnpmTarball},
+		"yarn": {DistTags: map[string]string{"latest": "1.22.22"}, Versions: []string{"1.22.22"}},
+		registry.BerryPackage: {
+			DistTags: map[string]string{"latest": "4.5.0"},
+			Versions: []string{"4.5.0"},
+			Tarball:  installertest.Tarball(t, installertest.BerryFiles),
+		},
+	})
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"pnpm@8"}, "pnpm@8.15.9"},
+		{[]string{"yarn@stable"}, "yarn@4.5.0"},
+		{[]string{"pnpm@8", "--hash"}, "pnpm@8.15.9+sha512." + hex.EncodeToString(pnpmSum[:])},
+		// For Yarn Berry corepack checks bin/yarn.js, not the tarball.
+		{[]string{"yarn@stable", "--hash"}, "yarn@4.5.0+sha512." + installertest.BerryHash},
+	}
+	for _, tt := range tests {
+		conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+		project := t.TempDir()
+		pkgJSON := filepath.Join(project, "package.json")
+		if err := os.WriteFile(pkgJSON, []byte(`{"name": "app", "packageManager": "npm@10.8.0"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Without a path, pin writes to the project the command runs in.
+		subdir := filepath.Join(project, "src")
+		if err := os.Mkdir(subdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(subdir)
+
+		cmd := newPinCmd(conf)
+		cmd.SetArgs(tt.args)
+		cmd.SilenceUsage, cmd.SilenceErrors = true, true
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("pin %v error = %v", tt.args, err)
+		}
+
+		data, err := os.ReadFile(pkgJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pkg struct{ PackageManager string }
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			t.Fatal(err)
+		}
+		if pkg.PackageManager != tt.want {
+			t.Errorf("pin %v wrote %s, want %s", tt.args, pkg.PackageManager, tt.want)
+		}
+		spec, err := inspector.ParseSpecString(tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !installer.IsInstalled(conf, spec) {
+			t.Errorf("pin %v didn't install %s", tt.args, tt.want)
+		}
+	}
+}
+
+func TestPinCmd_Policy(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir(), Registry: "http://127.0.0.1:0"}
+	if err := os.WriteFile(filepath.Join(conf.PmmDir, "policy.json"), []byte(`{"packageManagers": {"pnpm": {"blocked": {"9.0.x": "breaks our lockfile"}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project := t.TempDir()
+	pkgJSON := filepath.Join(project, "package.json")
+	if err := os.WriteFile(pkgJSON, []byte(`{"packageManager": "pnpm@8.15.6"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newPinCmd(conf)
+	cmd.SetArgs([]string{"pnpm@9.0.0-rc.1", project})
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	var violation *policy.Violation
+	if err := cmd.Execute(); !errors.As(err, &violation) {
+		t.Fatalf("expected a policy violation, got %v", err)
+	}
+
+	data, err := os.ReadFile(pkgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"packageManager": "pnpm@8.15.6"}` {
+		t.Errorf("package.json was rewritten: %s", data)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/spf13/cobra"
+)
+
+const defaultPruneDays = 30
+
+func newPruneCmd(conf *config.Config) *cobra.Command {
+	var days int
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove versions that aren't a default and haven't been used recently",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if days < 0 {
+				return fmt.Errorf("--days must not be negative")
+			}
+			entries, err := listInstalled(conf, nil)
+			if err != nil {
+				return err
+			}
+			cutoff := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+			return prune(conf, cmd.OutOrStdout(), pruneCandidates(entries, cutoff), dryRun)
+		},
+	}
+
+	cmd.Flags().IntVar(&days, "days", defaultPruneDays, "remove versions not used in this many days")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only report what would be removed")
+	return cmd
+}
+
+// pruneCandidates returns the entries that aren't a default and were last
+// used before cutoff.
+func pruneCandidates(entries []listEntry, cutoff time.Time) []listEntry {
+	var candidates []listEntry
+	for _, entry := range entries {
+		if !entry.Default && entry.LastUsed.Before(cutoff) {
+			candidates = append(candidates, entry)
+		}
+	}
+	return candidates
+}
+
+func prune(conf *config.Config, w io.Writer, candidates []listEntry, dryRun bool) error {
+	if len(candidates) == 0 {
+		fmt.Fprintln(w, "Nothing to prune.")
+		return nil
+	}
+
+	var reclaimed int64
+	var errs []error
+	for _, entry := range candidates {
+		if dryRun {
+			fmt.Fprintf(w, "Would remove %s@%s (%s)\n", entry.Name, entry.Version, formatSize(entry.Size))
+			reclaimed += entry.Size
+			continue
+		}
+		if err := installer.Uninstall(conf, inspector.PackageManagerSpec{Name: entry.Name, Version: entry.Version}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(w, "Removed %s@%s (%s)\n", entry.Name, entry.Version, formatSize(entry.Size))
+		reclaimed += entry.Size
+	}
+
+	if dryRun {
+		fmt.Fprintf(w, "Would reclaim %s (%d bytes)\n", formatSize(reclaimed), reclaimed)
+	} else {
+		fmt.Fprintf(w, "Reclaimed %s\n", formatSize(reclaimed))
+	}
+	return errors.Join(errs...)
+}
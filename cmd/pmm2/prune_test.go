@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+)
+
+func TestPruneCandidates(t *testing.T) {
+	now := time.Now()
+	entries := []listEntry{
+		{Name: "pnpm", Version: "8.15.9", LastUsed: now.Add(-60 * 24 * time.Hour)},
+		{Name: "pnpm", Version: "9.12.0", Default: true, LastUsed: now.Add(-60 * 24 * time.Hour)},
+		{Name: "yarn", Version: "1.22.22", LastUsed: now.Add(-time.Hour)},
+	}
+
+	candidates := pruneCandidates(entries, now.Add(-30*24*time.Hour))
+	if len(candidates) != 1 || candidates[0].Version != "8.15.9" {
+		t.Errorf("expected only pnpm@8.15.9, got %+v", candidates)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	installertest.FakeInstall(t, conf, "pnpm", "8.15.9")
+	candidates := []listEntry{{Name: "pnpm", Version: "8.15.9", Size: 2048}}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "8.15.9"}
+
+	var out bytes.Buffer
+	if err := prune(conf, &out, candidates, true); err != nil {
+		t.Fatalf("prune() dry run error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Would reclaim 2.0 KB (2048 bytes)") {
+		t.Errorf("unexpected dry run output:\n%s", out.String())
+	}
+	if !installer.IsInstalled(conf, spec) {
+		t.Fatal("expected dry run to keep pnpm@8.15.9")
+	}
+
+	out.Reset()
+	if err := prune(conf, &out, candidates, false); err != nil {
+		t.Fatalf("prune() error = %v", err)
+	}
+	if installer.IsInstalled(conf, spec) {
+		t.Error("expected pnpm@8.15.9 to be removed")
+	}
+	if !strings.Contains(out.String(), "Reclaimed 2.0 KB") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
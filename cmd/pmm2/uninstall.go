@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/defaults"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/resolver"
+	"github.com/spf13/cobra"
+)
+
+func newUninstallCmd(conf *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "uninstall <package-manager@version...>",
+		Short: "Remove installed package manager versions",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var errs []error
+			for _, arg := range args {
+				spec, err := inspector.ParseSpecString(arg)
+				if err != nil {
+					return err
+				}
+				if !resolver.IsExact(spec.Version) {
+					return fmt.Errorf("uninstall needs an exact version, got %s", arg)
+				}
+
+				if err := installer.Uninstall(conf, spec); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				fmt.Printf("Removed %s@%s\n", spec.Name, spec.Version)
+				if defaults.ReadDefault(conf, spec.Name) == spec.Version {
+					fmt.Printf("%s@%s is still the default and will be downloaded again the next time %s runs.\n", spec.Name, spec.Version, spec.Name)
+				}
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"github.com/ehyland/pmm2/internal/defaults"
 	"github.com/ehyland/pmm2/internal/inspector"
 	"github.com/ehyland/pmm2/internal/installer"
-	"github.com/ehyland/pmm2/internal/registry"
+	"github.com/ehyland/pmm2/internal/policy"
+	"github.com/ehyland/pmm2/internal/resolver"
 	"github.com/spf13/cobra"
 )
 
@@ -25,7 +26,7 @@ func newUpdateDefaultCmd(conf *config.Config) *cobra.Command {
 			var toUpdate []inspector.PackageManagerSpec
 			if name == "all" {
 				for _, pm := range config.GetSupportedPackageManagers() {
-					latest, err := registry.GetLatestVersion(conf, pm)
+					latest, err := resolver.Latest(conf, pm)
 					if err != nil {
 						return err
 					}
@@ -35,13 +36,24 @@ func newUpdateDefaultCmd(conf *config.Config) *cobra.Command {
 				if !config.IsSupported(name) {
 					return fmt.Errorf("unsupported package manager: %s", name)
 				}
-				latest, err := registry.GetLatestVersion(conf, name)
+				var target *inspector.PackageManagerSpec
+				var err error
+				if len(args) > 1 {
+					target, err = resolver.ResolveMature(conf, inspector.PackageManagerSpec{Name: name, Version: args[1]})
+				} else {
+					target, err = resolver.Latest(conf, name)
+				}
 				if err != nil {
 					return err
 				}
-				toUpdate = append(toUpdate, *latest)
+				toUpdate = append(toUpdate, *target)
 			}
 
+			for _, spec := range toUpdate {
+				if err := policy.Enforce(conf, spec); err != nil {
+					return err
+				}
+			}
 			for _, spec := range toUpdate {
 				if err := installer.Install(conf, spec); err != nil {
 					return err
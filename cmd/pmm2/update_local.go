@@ -2,43 +2,93 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/humanize"
 	"github.com/ehyland/pmm2/internal/inspector"
 	"github.com/ehyland/pmm2/internal/installer"
-	"github.com/ehyland/pmm2/internal/registry"
+	"github.com/ehyland/pmm2/internal/policy"
+	"github.com/ehyland/pmm2/internal/resolver"
 	"github.com/spf13/cobra"
 )
 
 func newUpdateLocalCmd(conf *config.Config) *cobra.Command {
-	return &cobra.Command{
+	var within string
+
+	cmd := &cobra.Command{
 		Use:   "update-local",
 		Short: "Update package manager version in package.json",
+		Long: `Update the packageManager field to the newest release, up to latest, that the
+project's engines.<package-manager> and engines.node allow. With
+PMM_MIN_RELEASE_AGE set, releases younger than that are skipped.
+
+--within minor stays on the current major, --within patch on the current minor.
+A range (pnpm@^9) is replaced by the newest release within it.
+A +sha512 hash in packageManager is recomputed for the new version.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			search, err := inspector.FindPackageManagerSpec()
+			search, err := inspector.FindPackageManagerSpec(conf)
 			if err != nil {
 				return err
 			}
 			if search == nil {
 				return fmt.Errorf("unable to find package.json with \"packageManager\" field")
 			}
+			// Only packageManager is rewritten; writing one next to
+			// devEngines or a lockfile would quietly take over from them.
+			if search.Field != inspector.FieldPackageManager {
+				return fmt.Errorf("%s takes its package manager from %s, which update-local doesn't edit; use pmm pin to write a packageManager field", search.PackageJSONPath, search.Field)
+			}
 
-			latest, err := registry.GetLatestVersion(conf, search.Spec.Name)
+			engines, err := inspector.ReadEngines(search.PackageJSONPath)
 			if err != nil {
-				return err
+				return fmt.Errorf("failed to read engines from %s: %w", search.PackageJSONPath, err)
 			}
 
-			if latest.Version == search.Spec.Version {
-				fmt.Printf("Already on latest version %s@%s\n", search.Spec.Name, latest.Version)
+			target, skipped, err := resolver.FindUpdate(conf, search.Spec, within, engines)
+			if err != nil {
+				return err
+			}
+			if len(skipped) > 0 {
+				fmt.Fprintf(os.Stderr, "Skipping %s@%s: %s\n", search.Spec.Name, skipped[0].Version, skipped[0].Reason)
+				if len(skipped) > 1 {
+					fmt.Fprintf(os.Stderr, "Skipping %s\n", humanize.Plural(len(skipped)-1, "other newer version"))
+				}
+			}
+			if target == nil {
+				fmt.Printf("Already on the newest compatible version %s@%s\n", search.Spec.Name, search.Spec.Version)
 				return nil
 			}
 
-			if err := installer.Install(conf, *latest); err != nil {
+			// A hashed spec stays hashed, or it would silently lose its
+			// integrity check.
+			repin := fmt.Sprintf("re-pin with: pmm pin %s@%s --hash", target.Name, target.Version)
+			if search.Spec.Hash != "" && search.Spec.HashAlgorithm != "sha512" {
+				return fmt.Errorf("%s pins a %s hash, which update-local can't compute; %s", search.PackageJSONPath, search.Spec.HashAlgorithm, repin)
+			}
+
+			if err := policy.Enforce(conf, *target); err != nil {
+				return err
+			}
+			if err := installer.Install(conf, *target); err != nil {
 				return err
 			}
 
-			fmt.Printf("Updating %s to %s@%s\n", search.PackageJSONPath, latest.Name, latest.Version)
-			return inspector.UpdateSpecInPackageJSON(search.PackageJSONPath, *latest)
+			if search.Spec.Hash != "" {
+				hash, err := installer.CorepackSHA512(conf, *target)
+				if err != nil {
+					return fmt.Errorf("failed to hash %s@%s: %w; %s", target.Name, target.Version, err, repin)
+				}
+				target.HashAlgorithm = "sha512"
+				target.Hash = hash
+			}
+
+			fmt.Printf("Updating %s to %s@%s\n", search.PackageJSONPath, target.Name, target.Version)
+			return inspector.UpdateSpecInPackageJSON(search.PackageJSONPath, *target)
 		},
 	}
+
+	cmd.Flags().StringVar(&within, "within", resolver.WithinMajor, "largest update to take: major, minor or patch")
+	return cmd
 }
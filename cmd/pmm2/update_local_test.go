@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+)
+
+// newPnpmRegistry serves pnpm 9.0.0 and 9.1.0, both from tarball.
+func newPnpmRegistry(t *testing.T, tarball []byte) *httptest.Server {
+	return installertest.NewRegistry(t, map[string]installertest.Package{
+		"pnpm": {DistTags: map[string]string{"latest": "9.1.0"}, Versions: []string{"9.0.0", "9.1.0"}, Tarball: tarball},
+	})
+}
+
+func TestUpdateLocalCmd_KeepsHash(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	sum := sha512.Sum512(tarball)
+	server := newPnpmRegistry(t, tarball)
+
+	tests := []struct {
+		current string
+		want    string
+		wantErr string
+	}{
+		{"pnpm@9.0.0+sha512." + strings.Repeat("ab", sha512.Size), "pnpm@9.1.0+sha512." + hex.EncodeToString(sum[:]), ""},
+		{"pnpm@9.0.0+sha256." + strings.Repeat("ab", 32), "", "re-pin with: pmm pin pnpm@9.1.0 --hash"},
+	}
+	for _, tt := range tests {
+		conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+		project := t.TempDir()
+		pkgJSON := filepath.Join(project, "package.json")
+		original := `{"packageManager": "` + tt.current + `"}`
+		if err := os.WriteFile(pkgJSON, []byte(original), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(project)
+
+		cmd := newUpdateLocalCmd(conf)
+		cmd.SetArgs([]string{})
+		cmd.SilenceUsage, cmd.SilenceErrors = true, true
+		err := cmd.Execute()
+
+		data, readErr := os.ReadFile(pkgJSON)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("update-local from %s error = %v, want %q", tt.current, err, tt.wantErr)
+			}
+			if string(data) != original {
+				t.Errorf("package.json was rewritten: %s", data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("update-local from %s error = %v", tt.current, err)
+		}
+		var pkg struct{ PackageManager string }
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			t.Fatal(err)
+		}
+		if pkg.PackageManager != tt.want {
+			t.Errorf("update-local from %s wrote %s, want %s", tt.current, pkg.PackageManager, tt.want)
+		}
+	}
+}
+
+func TestUpdateLocalCmd_Field(t *testing.T) {
+	server := newPnpmRegistry(t, installertest.Tarball(t, installertest.PnpmFiles))
+
+	tests := []struct {
+		pkgJSON string
+		want    string
+		wantErr string
+	}{
+		{`{"packageManager": "pnpm@^9"}`, `{"packageManager": "pnpm@9.1.0"}`, ""},
+		{`{"devEngines": {"packageManager": {"name": "pnpm", "version": "^9"}}}`, "", "update-local doesn't edit"},
+	}
+	for _, tt := range tests {
+		conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+		project := t.TempDir()
+		pkgJSON := filepath.Join(project, "package.json")
+		if err := os.WriteFile(pkgJSON, []byte(tt.pkgJSON), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Chdir(project)
+
+		cmd := newUpdateLocalCmd(conf)
+		cmd.SetArgs([]string{})
+		cmd.SilenceUsage, cmd.SilenceErrors = true, true
+		err := cmd.Execute()
+
+		data, readErr := os.ReadFile(pkgJSON)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("update-local in %s error = %v, want %q", tt.pkgJSON, err, tt.wantErr)
+			}
+			if string(data) != tt.pkgJSON {
+				t.Errorf("package.json was rewritten: %s", data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("update-local in %s error = %v", tt.pkgJSON, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("update-local in %s wrote %s, want %s", tt.pkgJSON, data, tt.want)
+		}
+	}
+}
@@ -3,16 +3,78 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ehyland/pmm2/internal/npmrc"
 )
 
 var supportedPackageManagers = []string{"pnpm", "npm", "yarn", "bun"}
 var shims = []string{"npm", "npx", "pnpm", "pnpx", "yarn", "bun", "bunx"}
 
+// DefaultLockTimeout is how long a shim waits for another process that is
+// installing the same package manager version.
+const DefaultLockTimeout = 5 * time.Minute
+
+// DefaultResolveTTL is how long a range or dist-tag stays resolved to the
+// same version before the registry is asked again.
+const DefaultResolveTTL = 24 * time.Hour
+
+// DefaultMetadataTTL is how long cached registry metadata is used before it
+// is revalidated.
+const DefaultMetadataTTL = 5 * time.Minute
+
+// Defaults for registry and download traffic. ConnectTimeout bounds dialing
+// and the TLS handshake, ReadTimeout how long a response may stall.
+const (
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultReadTimeout    = 30 * time.Second
+	DefaultHTTPRetries    = 3
+)
+
+// DefaultBunDownloadURL is where bun release zips are fetched from unless
+// PMM_BUN_DOWNLOAD_URL names mirrors.
+const DefaultBunDownloadURL = "https://github.com/oven-sh/bun/releases/download"
+
 type Config struct {
-	Registry           string
+	Registry string
+	// FallbackRegistries are tried in order when Registry fails or times out.
+	FallbackRegistries []string
+	// BunDownloadURLs are base URLs serving bun-v<version>/bun-<os>-<arch>.zip,
+	// tried in order.
+	BunDownloadURLs    []string
 	PmmDir             string
 	IgnoreSpecMismatch bool
+	InferFromLockfile  bool
+	// PolicyFile is the organization version policy. Empty means
+	// PmmDir/policy.json, if it exists.
+	PolicyFile   string
+	IgnorePolicy bool
+	// Offline disables registry and download requests; only installed
+	// versions and cached metadata are used.
+	Offline bool
+	// OfflineFallback switches to offline mode after a network failure
+	// instead of failing.
+	OfflineFallback bool
+	LockTimeout     time.Duration
+	// MinReleaseAge is how long a release must have been public before
+	// pmm2 adopts it as a new version. Zero disables the cooldown.
+	MinReleaseAge  time.Duration
+	ResolveTTL     time.Duration
+	MetadataTTL    time.Duration
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	// HTTPRetries is how many times a failed request is retried. Zero
+	// disables retries.
+	HTTPRetries int
+	// UserAgent is sent with every request, e.g. "pmm2/2.1.0".
+	UserAgent string
+	// CAFiles are PEM bundles trusted for registry and download traffic, on
+	// top of the system roots.
+	CAFiles []string
+	NpmRC   *npmrc.Config
 }
 
 func GetSupportedPackageManagers() []string {
@@ -24,28 +86,100 @@ func GetShims() []string {
 }
 
 func LoadConfig() *Config {
-	registry := os.Getenv("PMM_NPM_REGISTRY")
-	if registry == "" {
-		registry = "https://registry.npmjs.org"
+	home, _ := os.UserHomeDir()
+	cwd, _ := os.Getwd()
+	rc := npmrc.Load(cwd, home)
+
+	registries := parseURLList(os.Getenv("PMM_NPM_REGISTRY"))
+	if len(registries) == 0 {
+		registries = parseURLList(rc.Registry())
+	}
+	if len(registries) == 0 {
+		registries = []string{"https://registry.npmjs.org"}
+	}
+
+	bunDownloadURLs := parseURLList(os.Getenv("PMM_BUN_DOWNLOAD_URL"))
+	if len(bunDownloadURLs) == 0 {
+		bunDownloadURLs = []string{DefaultBunDownloadURL}
 	}
 
 	pmmDir := os.Getenv("PMM2_DIR")
 	if pmmDir == "" {
-		home, _ := os.UserHomeDir()
 		pmmDir = filepath.Join(home, ".pmm2")
 	}
 
-	ignoreStr := os.Getenv("PMM_IGNORE_SPEC_MISS_MATCH")
-	ignore := false
-	if strings.ToLower(ignoreStr) == "yes" || strings.ToLower(ignoreStr) == "true" || ignoreStr == "1" {
-		ignore = true
+	ignore := parseBool(os.Getenv("PMM_IGNORE_SPEC_MISS_MATCH"))
+
+	var caFiles []string
+	for _, path := range []string{rc.Get("cafile"), os.Getenv("NODE_EXTRA_CA_CERTS"), os.Getenv("PMM_CA_FILE")} {
+		if path != "" {
+			caFiles = append(caFiles, path)
+		}
+	}
+
+	retries := DefaultHTTPRetries
+	if n, err := strconv.Atoi(os.Getenv("PMM_HTTP_RETRIES")); err == nil && n >= 0 {
+		retries = n
 	}
 
 	return &Config{
-		Registry:           registry,
+		Registry:           registries[0],
+		FallbackRegistries: registries[1:],
+		BunDownloadURLs:    bunDownloadURLs,
+		CAFiles:            caFiles,
+		NpmRC:              rc,
 		PmmDir:             pmmDir,
 		IgnoreSpecMismatch: ignore,
+		InferFromLockfile:  parseBool(os.Getenv("PMM_INFER_FROM_LOCKFILE")),
+		PolicyFile:         os.Getenv("PMM_POLICY_FILE"),
+		IgnorePolicy:       parseBool(os.Getenv("PMM_IGNORE_POLICY")),
+		Offline:            parseBool(os.Getenv("PMM_OFFLINE")),
+		OfflineFallback:    parseBool(os.Getenv("PMM_OFFLINE_FALLBACK")),
+		LockTimeout:        parseDuration(os.Getenv("PMM_LOCK_TIMEOUT"), DefaultLockTimeout),
+		MinReleaseAge:      parseDuration(os.Getenv("PMM_MIN_RELEASE_AGE"), 0),
+		ResolveTTL:         parseDuration(os.Getenv("PMM_RESOLVE_TTL"), DefaultResolveTTL),
+		MetadataTTL:        parseDuration(os.Getenv("PMM_METADATA_TTL"), DefaultMetadataTTL),
+		ConnectTimeout:     parseDuration(os.Getenv("PMM_CONNECT_TIMEOUT"), DefaultConnectTimeout),
+		ReadTimeout:        parseDuration(os.Getenv("PMM_READ_TIMEOUT"), DefaultReadTimeout),
+		HTTPRetries:        retries,
+		UserAgent:          "pmm2/dev",
+	}
+}
+
+func parseBool(value string) bool {
+	value = strings.ToLower(value)
+	return value == "yes" || value == "true" || value == "1"
+}
+
+// parseURLList splits a comma or whitespace separated list of base URLs,
+// dropping trailing slashes.
+func parseURLList(value string) []string {
+	var urls []string
+	for _, url := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		urls = append(urls, strings.TrimSuffix(url, "/"))
+	}
+	return urls
+}
+
+// parseDuration accepts Go durations ("90s", "5m"), a number of days ("7d")
+// or a plain number of seconds, returning fallback for empty or invalid
+// values.
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && strings.HasSuffix(value, "d") {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
 	}
+	return fallback
 }
 
 func IsSupported(name string) bool {
@@ -3,13 +3,17 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
 	os.Setenv("PMM_NPM_REGISTRY", "https://test.registry.org")
 	os.Setenv("PMM2_DIR", "/tmp/.pmm-test")
 	os.Setenv("PMM_IGNORE_SPEC_MISS_MATCH", "true")
+	os.Setenv("PMM_LOCK_TIMEOUT", "90")
+	defer os.Unsetenv("PMM_LOCK_TIMEOUT")
 
 	conf := LoadConfig()
 
@@ -24,9 +28,14 @@ func TestLoadConfig(t *testing.T) {
 	if !conf.IgnoreSpecMismatch {
 		t.Errorf("expected IgnoreSpecMismatch true, got false")
 	}
+
+	if conf.LockTimeout != 90*time.Second {
+		t.Errorf("expected LockTimeout 90s, got %s", conf.LockTimeout)
+	}
 }
 
 func TestLoadConfig_Defaults(t *testing.T) {
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(t.TempDir(), ".npmrc"))
 	os.Unsetenv("PMM_NPM_REGISTRY")
 	os.Unsetenv("PMM2_DIR")
 	os.Unsetenv("PMM_IGNORE_SPEC_MISS_MATCH")
@@ -37,6 +46,14 @@ func TestLoadConfig_Defaults(t *testing.T) {
 		t.Errorf("expected default registry, got %s", conf.Registry)
 	}
 
+	if len(conf.FallbackRegistries) != 0 {
+		t.Errorf("expected no fallback registries, got %v", conf.FallbackRegistries)
+	}
+
+	if !reflect.DeepEqual(conf.BunDownloadURLs, []string{DefaultBunDownloadURL}) {
+		t.Errorf("expected default bun download URL, got %v", conf.BunDownloadURLs)
+	}
+
 	home, _ := os.UserHomeDir()
 	expectedDir := filepath.Join(home, ".pmm2")
 	if conf.PmmDir != expectedDir {
@@ -46,6 +63,145 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	if conf.IgnoreSpecMismatch {
 		t.Errorf("expected default IgnoreSpecMismatch false, got true")
 	}
+
+	if conf.InferFromLockfile {
+		t.Errorf("expected default InferFromLockfile false, got true")
+	}
+
+	if conf.LockTimeout != DefaultLockTimeout {
+		t.Errorf("expected default LockTimeout %s, got %s", DefaultLockTimeout, conf.LockTimeout)
+	}
+
+	if conf.ResolveTTL != DefaultResolveTTL {
+		t.Errorf("expected default ResolveTTL %s, got %s", DefaultResolveTTL, conf.ResolveTTL)
+	}
+
+	if conf.MetadataTTL != DefaultMetadataTTL {
+		t.Errorf("expected default MetadataTTL %s, got %s", DefaultMetadataTTL, conf.MetadataTTL)
+	}
+
+	if conf.ConnectTimeout != DefaultConnectTimeout || conf.ReadTimeout != DefaultReadTimeout {
+		t.Errorf("expected default timeouts, got %s/%s", conf.ConnectTimeout, conf.ReadTimeout)
+	}
+
+	if conf.HTTPRetries != DefaultHTTPRetries {
+		t.Errorf("expected default HTTPRetries %d, got %d", DefaultHTTPRetries, conf.HTTPRetries)
+	}
+
+	if conf.MinReleaseAge != 0 {
+		t.Errorf("expected no default MinReleaseAge, got %s", conf.MinReleaseAge)
+	}
+}
+
+func TestLoadConfig_Policy(t *testing.T) {
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(t.TempDir(), ".npmrc"))
+	t.Setenv("PMM_POLICY_FILE", "/etc/pmm2/policy.json")
+	t.Setenv("PMM_IGNORE_POLICY", "1")
+
+	conf := LoadConfig()
+	if conf.PolicyFile != "/etc/pmm2/policy.json" || !conf.IgnorePolicy {
+		t.Errorf("expected PolicyFile and IgnorePolicy, got %q/%v", conf.PolicyFile, conf.IgnorePolicy)
+	}
+}
+
+func TestLoadConfig_MinReleaseAge(t *testing.T) {
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(t.TempDir(), ".npmrc"))
+	t.Setenv("PMM_MIN_RELEASE_AGE", "3d")
+
+	conf := LoadConfig()
+	if conf.MinReleaseAge != 72*time.Hour {
+		t.Errorf("expected MinReleaseAge 72h, got %s", conf.MinReleaseAge)
+	}
+}
+
+func TestLoadConfig_HTTP(t *testing.T) {
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(t.TempDir(), ".npmrc"))
+	t.Setenv("PMM_CONNECT_TIMEOUT", "5")
+	t.Setenv("PMM_READ_TIMEOUT", "1m")
+	t.Setenv("PMM_HTTP_RETRIES", "0")
+
+	conf := LoadConfig()
+	if conf.ConnectTimeout != 5*time.Second {
+		t.Errorf("expected ConnectTimeout 5s, got %v", conf.ConnectTimeout)
+	}
+	if conf.ReadTimeout != time.Minute {
+		t.Errorf("expected ReadTimeout 1m, got %v", conf.ReadTimeout)
+	}
+	if conf.HTTPRetries != 0 {
+		t.Errorf("expected HTTPRetries 0, got %d", conf.HTTPRetries)
+	}
+}
+
+func TestLoadConfig_Offline(t *testing.T) {
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(t.TempDir(), ".npmrc"))
+	t.Setenv("PMM_OFFLINE", "1")
+	t.Setenv("PMM_OFFLINE_FALLBACK", "true")
+
+	conf := LoadConfig()
+	if !conf.Offline || !conf.OfflineFallback {
+		t.Errorf("expected Offline and OfflineFallback, got %v/%v", conf.Offline, conf.OfflineFallback)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"", time.Minute},
+		{"30", 30 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"7d", 7 * 24 * time.Hour},
+		{"d", time.Minute},
+		{"soon", time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := parseDuration(tt.input, time.Minute); got != tt.expected {
+			t.Errorf("parseDuration(%q) = %s; want %s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadConfig_NpmrcRegistry(t *testing.T) {
+	npmrcPath := filepath.Join(t.TempDir(), ".npmrc")
+	if err := os.WriteFile(npmrcPath, []byte("registry=https://npm.example.com/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NPM_CONFIG_USERCONFIG", npmrcPath)
+	t.Setenv("PMM_NPM_REGISTRY", "")
+
+	conf := LoadConfig()
+	if conf.Registry != "https://npm.example.com" {
+		t.Errorf("expected registry from .npmrc, got %s", conf.Registry)
+	}
+
+	t.Setenv("PMM_NPM_REGISTRY", "https://env.example.com")
+	conf = LoadConfig()
+	if conf.Registry != "https://env.example.com" {
+		t.Errorf("expected PMM_NPM_REGISTRY to win over .npmrc, got %s", conf.Registry)
+	}
+}
+
+func TestLoadConfig_CAFiles(t *testing.T) {
+	npmrcPath := filepath.Join(t.TempDir(), ".npmrc")
+	if err := os.WriteFile(npmrcPath, []byte("cafile=/etc/npm-ca.pem\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NPM_CONFIG_USERCONFIG", npmrcPath)
+	t.Setenv("NODE_EXTRA_CA_CERTS", "/etc/node-ca.pem")
+	t.Setenv("PMM_CA_FILE", "/etc/pmm-ca.pem")
+
+	conf := LoadConfig()
+	expected := []string{"/etc/npm-ca.pem", "/etc/node-ca.pem", "/etc/pmm-ca.pem"}
+	if len(conf.CAFiles) != len(expected) {
+		t.Fatalf("expected CAFiles %v, got %v", expected, conf.CAFiles)
+	}
+	for i := range expected {
+		if conf.CAFiles[i] != expected[i] {
+			t.Errorf("expected CAFiles %v, got %v", expected, conf.CAFiles)
+		}
+	}
 }
 
 func TestIsSupported(t *testing.T) {
@@ -65,3 +221,20 @@ func TestIsSupported(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadConfig_RegistryList(t *testing.T) {
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(t.TempDir(), ".npmrc"))
+	t.Setenv("PMM_NPM_REGISTRY", "https://npm.internal/, https://registry.npmjs.org")
+	t.Setenv("PMM_BUN_DOWNLOAD_URL", "https://mirror.internal/bun/")
+
+	conf := LoadConfig()
+	if conf.Registry != "https://npm.internal" {
+		t.Errorf("expected primary registry https://npm.internal, got %s", conf.Registry)
+	}
+	if !reflect.DeepEqual(conf.FallbackRegistries, []string{"https://registry.npmjs.org"}) {
+		t.Errorf("unexpected FallbackRegistries %v", conf.FallbackRegistries)
+	}
+	if !reflect.DeepEqual(conf.BunDownloadURLs, []string{"https://mirror.internal/bun"}) {
+		t.Errorf("unexpected BunDownloadURLs %v", conf.BunDownloadURLs)
+	}
+}
@@ -7,33 +7,59 @@ import (
 
 	"github.com/ehyland/pmm2/internal/config"
 	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
 	"github.com/ehyland/pmm2/internal/registry"
+	"github.com/ehyland/pmm2/internal/resolver"
 )
 
 func GetDefaultFilePath(conf *config.Config, name string) string {
 	return filepath.Join(conf.PmmDir, "installed-versions", ".defaults", name+"-version")
 }
 
+// ReadDefault returns the saved default version of name, or "" if none has
+// been set yet. Unlike GetDefaultVersion it never touches the registry.
+func ReadDefault(conf *config.Config, name string) string {
+	data, err := os.ReadFile(GetDefaultFilePath(conf, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
 func GetDefaultVersion(conf *config.Config, name string) (string, error) {
-	path := GetDefaultFilePath(conf, name)
-	data, err := os.ReadFile(path)
-	if err == nil {
-		version := strings.TrimSpace(string(data))
-		if version != "" {
-			return version, nil
+	if version := ReadDefault(conf, name); version != "" {
+		return version, nil
+	}
+
+	if !registry.IsOffline(conf) {
+		latest, err := resolver.Latest(conf, name)
+		// The lookup itself may have switched us to offline mode, in which
+		// case latest comes from cached metadata and may not be installed.
+		if err == nil && !registry.IsOffline(conf) {
+			if err := UpdateDefault(conf, *latest); err != nil {
+				return "", err
+			}
+			return latest.Version, nil
+		}
+		if err != nil && !registry.IsOffline(conf) {
+			return "", err
 		}
 	}
 
-	latest, err := registry.GetLatestVersion(conf, name)
+	return newestInstalled(conf, name)
+}
+
+// newestInstalled stands in for the latest version while offline. It is not
+// saved as the default, so the real latest is picked up once back online.
+func newestInstalled(conf *config.Config, name string) (string, error) {
+	installed, err := installer.ListInstalled(conf, name)
 	if err != nil {
 		return "", err
 	}
-
-	if err := UpdateDefault(conf, *latest); err != nil {
-		return "", err
+	if len(installed) == 0 {
+		return "", installer.NewOfflineError(conf, inspector.PackageManagerSpec{Name: name})
 	}
-
-	return latest.Version, nil
+	return installed[len(installed)-1], nil
 }
 
 func UpdateDefault(conf *config.Config, spec inspector.PackageManagerSpec) error {
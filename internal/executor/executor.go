@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,56 +12,75 @@ import (
 	"github.com/ehyland/pmm2/internal/defaults"
 	"github.com/ehyland/pmm2/internal/inspector"
 	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/policy"
+	"github.com/ehyland/pmm2/internal/resolver"
 )
 
 type SpecMismatchError struct {
 	Expected string
 	Path     string
+	Field    string
 }
 
 func (e *SpecMismatchError) Error() string {
 	relPath, _ := filepath.Rel(".", e.Path)
-	return fmt.Sprintf("⚠️  This project is configured to use %s.\nSee \"packageManager\" field in ./%s\n\nYou can ignore this error by setting the environment variable PMM_IGNORE_SPEC_MISS_MATCH=1", e.Expected, relPath)
+	source := fmt.Sprintf("See \"%s\" field in ./%s", e.Field, relPath)
+	switch e.Field {
+	case "":
+		source = fmt.Sprintf("See \"%s\" field in ./%s", inspector.FieldPackageManager, relPath)
+	case inspector.FieldLockfile:
+		source = fmt.Sprintf("Inferred from ./%s", relPath)
+	}
+	return fmt.Sprintf("⚠️  This project is configured to use %s.\n%s\n\nYou can ignore this error by setting the environment variable PMM_IGNORE_SPEC_MISS_MATCH=1", e.Expected, source)
 }
 
-func RunPackageManager(conf *config.Config, packageManagerName string, executableName string, args []string) error {
-	if !config.IsSupported(packageManagerName) {
-		return fmt.Errorf("unsupported package manager: %s", packageManagerName)
-	}
+// DevEngineError is returned when devEngines.packageManager asks for a range
+// that the default version doesn't satisfy and onFail is "error".
+type DevEngineError struct {
+	Name      string
+	Version   string
+	Available string
+	Path      string
+}
+
+func (e *DevEngineError) Error() string {
+	relPath, _ := filepath.Rel(".", e.Path)
+	return fmt.Sprintf("⚠️  This project requires %s@%s, but the default is %s@%s.\nSee \"%s\" field in ./%s\n\nSet \"onFail\": \"%s\" to install a matching version automatically, or run: pmm update-default %s \"%s\"", e.Name, e.Version, e.Name, e.Available, inspector.FieldDevEngines, relPath, inspector.OnFailDownload, e.Name, e.Version)
+}
 
-	found, err := inspector.FindPackageManagerSpec()
+func RunPackageManager(conf *config.Config, packageManagerName string, executableName string, args []string) error {
+	spec, found, err := findProjectSpec(conf, packageManagerName, defaults.GetDefaultVersion)
 	if err != nil {
-		return fmt.Errorf("failed to find package manager spec: %w", err)
+		return err
 	}
 
-	var spec *inspector.PackageManagerSpec
-	if found != nil {
-		if found.Spec.Name != packageManagerName {
-			// TODO: move bun exception to config
-			if packageManagerName == "bun" || conf.IgnoreSpecMismatch {
-				spec = nil
-			} else {
-				return &SpecMismatchError{
-					Expected: found.Spec.Name,
-					Path:     found.PackageJSONPath,
-				}
-			}
-		} else {
-			spec = &found.Spec
-		}
-	}
+	env := os.Environ()
+	env = append(env, "PMM_IGNORE_SPEC_MISS_MATCH=1")
 
-	if spec == nil {
-		version, err := defaults.GetDefaultVersion(conf, packageManagerName)
+	// A release checked in via yarnPath takes precedence over packageManager
+	// and devEngines, the same as when Yarn itself reads .yarnrc.yml.
+	if packageManagerName == "yarn" {
+		yarnPath, err := projectYarnPath(conf, found)
 		if err != nil {
-			return fmt.Errorf("failed to get default version: %w", err)
+			return err
 		}
-		spec = &inspector.PackageManagerSpec{
-			Name:    packageManagerName,
-			Version: version,
+		if yarnPath != "" {
+			if err := checkYarnPath(conf, spec, yarnPath); err != nil {
+				return err
+			}
+			return execNode(yarnPath, args, env)
 		}
 	}
 
+	spec, err = resolveVersion(conf, packageManagerName, spec)
+	if err != nil {
+		return err
+	}
+
+	if err := policy.Enforce(conf, *spec); err != nil {
+		return err
+	}
+
 	if err := installer.Install(conf, *spec); err != nil {
 		return fmt.Errorf("failed to install: %w", err)
 	}
@@ -70,14 +90,236 @@ func RunPackageManager(conf *config.Config, packageManagerName string, executabl
 		return fmt.Errorf("failed to get executable path: %w", err)
 	}
 
-	cmdArgs := append([]string{exePath}, args...)
-	env := os.Environ()
-	env = append(env, "PMM_IGNORE_SPEC_MISS_MATCH=1")
+	// Only feeds pmm list and prune, so a read-only store isn't an error.
+	installer.MarkUsed(conf, *spec)
 
 	if packageManagerName == "bun" {
 		return syscall.Exec(exePath, append([]string{executableName}, args...), env)
 	}
 
+	return execNode(exePath, args, env)
+}
+
+// projectYarnPath returns the release the project's .yarnrc.yml points
+// yarnPath at, or "" if there is none. found is the project's package
+// manager configuration, if it has any.
+func projectYarnPath(conf *config.Config, found *inspector.FoundSpec) (string, error) {
+	if found != nil {
+		return inspector.FindYarnPath(found.PackageJSONPath)
+	}
+	pkgJSONPath, err := inspector.FindProjectPackageJSON(conf)
+	if err != nil {
+		// Outside of any project there is no .yarnrc.yml to read.
+		return "", nil
+	}
+	return inspector.FindYarnPath(pkgJSONPath)
+}
+
+// checkYarnPath warns when the yarnPath release disagrees with the
+// project's spec, if any, and applies the policy to it. A release whose
+// version can't be told from its file name can't be checked against a yarn
+// policy.
+func checkYarnPath(conf *config.Config, spec *inspector.PackageManagerSpec, yarnPath string) error {
+	v := inspector.YarnPathVersion(yarnPath)
+	if v == "" {
+		return policy.EnforceUnknown(conf, "yarn", yarnPath)
+	}
+	if spec != nil && resolver.IsExact(spec.Version) && v != spec.Version {
+		fmt.Fprintf(os.Stderr, "⚠️  packageManager is yarn@%s but yarnPath points at yarn@%s, using yarnPath\n", spec.Version, v)
+	}
+	return policy.Enforce(conf, inspector.PackageManagerSpec{Name: "yarn", Version: v})
+}
+
+// ResolveSpec returns the exact version of packageManagerName that running
+// it in the current directory would use, without installing it.
+func ResolveSpec(conf *config.Config, packageManagerName string) (*inspector.PackageManagerSpec, error) {
+	spec, _, err := findProjectSpec(conf, packageManagerName, defaults.GetDefaultVersion)
+	if err != nil {
+		return nil, err
+	}
+	return resolveVersion(conf, packageManagerName, spec)
+}
+
+// errNoDefault is returned by readDefault when no default version is set.
+var errNoDefault = errors.New("no default version")
+
+func readDefault(conf *config.Config, name string) (string, error) {
+	if version := defaults.ReadDefault(conf, name); version != "" {
+		return version, nil
+	}
+	return "", errNoDefault
+}
+
+// LocalSpec is ResolveSpec without side effects: it never reaches the
+// registry or writes a default. When the version can't be worked out from
+// the project, the defaults and the resolution cache, the returned spec has
+// an empty Version.
+func LocalSpec(conf *config.Config, packageManagerName string) (*inspector.PackageManagerSpec, error) {
+	unknown := &inspector.PackageManagerSpec{Name: packageManagerName}
+	spec, _, err := findProjectSpec(conf, packageManagerName, readDefault)
+	if errors.Is(err, errNoDefault) {
+		return unknown, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if spec == nil {
+		version, err := readDefault(conf, packageManagerName)
+		if err != nil {
+			return unknown, nil
+		}
+		return &inspector.PackageManagerSpec{Name: packageManagerName, Version: version}, nil
+	}
+	if resolver.IsExact(spec.Version) {
+		return spec, nil
+	}
+	if version, ok := resolver.Cached(conf, *spec); ok {
+		return &inspector.PackageManagerSpec{Name: spec.Name, Version: version}, nil
+	}
+	return &inspector.PackageManagerSpec{Name: spec.Name}, nil
+}
+
+// findProjectSpec applies the project's package manager configuration to
+// packageManagerName, looking up default versions with defaultVersion. A nil
+// spec means the default version should run.
+func findProjectSpec(conf *config.Config, packageManagerName string, defaultVersion func(*config.Config, string) (string, error)) (*inspector.PackageManagerSpec, *inspector.FoundSpec, error) {
+	if !config.IsSupported(packageManagerName) {
+		return nil, nil, fmt.Errorf("unsupported package manager: %s", packageManagerName)
+	}
+
+	found, err := inspector.FindPackageManagerSpec(conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find package manager spec: %w", err)
+	}
+	if found == nil {
+		return nil, nil, nil
+	}
+
+	if found.Field == inspector.FieldDevEngines {
+		spec, err := resolveDevEngine(conf, found, packageManagerName, defaultVersion)
+		return spec, found, err
+	}
+
+	if found.Spec.Name != packageManagerName {
+		// TODO: move bun exception to config
+		if packageManagerName == "bun" || conf.IgnoreSpecMismatch {
+			return nil, found, nil
+		}
+		mismatch := &SpecMismatchError{
+			Expected: found.Spec.Name,
+			Path:     found.PackageJSONPath,
+			Field:    found.Field,
+		}
+		if found.Field == inspector.FieldLockfile {
+			mismatch.Path = found.LockfilePath
+		}
+		return nil, nil, mismatch
+	}
+
+	if found.Field == inspector.FieldLockfile {
+		spec, err := resolveInferred(conf, found.Spec, defaultVersion)
+		return spec, found, err
+	}
+	return &found.Spec, found, nil
+}
+
+// resolveVersion turns spec into an exact version, falling back to the
+// default version of packageManagerName when spec is nil.
+func resolveVersion(conf *config.Config, packageManagerName string, spec *inspector.PackageManagerSpec) (*inspector.PackageManagerSpec, error) {
+	if spec != nil {
+		spec, err := resolver.Resolve(conf, *spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve version: %w", err)
+		}
+		return spec, nil
+	}
+
+	version, err := defaults.GetDefaultVersion(conf, packageManagerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default version: %w", err)
+	}
+	return &inspector.PackageManagerSpec{
+		Name:    packageManagerName,
+		Version: version,
+	}, nil
+}
+
+// resolveDevEngine applies devEngines.packageManager for the invoked package
+// manager. A nil spec means the default version should run.
+func resolveDevEngine(conf *config.Config, found *inspector.FoundSpec, packageManagerName string, defaultVersion func(*config.Config, string) (string, error)) (*inspector.PackageManagerSpec, error) {
+	engine := found.DevEngine(packageManagerName)
+	if engine == nil {
+		if packageManagerName == "bun" || conf.IgnoreSpecMismatch {
+			return nil, nil
+		}
+		mismatch := &SpecMismatchError{Expected: found.Spec.Name, Path: found.PackageJSONPath, Field: found.Field}
+		switch found.DevEngines[0].OnFail {
+		case inspector.OnFailIgnore:
+			return nil, nil
+		case inspector.OnFailWarn:
+			fmt.Fprintf(os.Stderr, "%v\n\n", mismatch)
+			return nil, nil
+		}
+		return nil, mismatch
+	}
+
+	if engine.Version == "" {
+		return nil, nil
+	}
+	if engine.OnFail == inspector.OnFailDownload {
+		return &inspector.PackageManagerSpec{Name: engine.Name, Version: engine.Version}, nil
+	}
+
+	// The other modes only accept the version that would run anyway.
+	available, err := defaultVersion(conf, packageManagerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default version: %w", err)
+	}
+	ok, err := resolver.Satisfies(available, engine.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", inspector.FieldDevEngines, found.PackageJSONPath, err)
+	}
+	if ok {
+		return nil, nil
+	}
+
+	unsatisfied := &DevEngineError{Name: engine.Name, Version: engine.Version, Available: available, Path: found.PackageJSONPath}
+	switch engine.OnFail {
+	case inspector.OnFailIgnore:
+		return nil, nil
+	case inspector.OnFailWarn:
+		fmt.Fprintf(os.Stderr, "%v\n\n", unsatisfied)
+		return nil, nil
+	}
+	return nil, unsatisfied
+}
+
+// resolveInferred prefers the default version for a spec inferred from a
+// lockfile, as long as it writes a compatible lockfile. A nil spec means the
+// default version should run.
+func resolveInferred(conf *config.Config, inferred inspector.PackageManagerSpec, defaultVersion func(*config.Config, string) (string, error)) (*inspector.PackageManagerSpec, error) {
+	if inferred.Version == "" {
+		return nil, nil
+	}
+
+	available, err := defaultVersion(conf, inferred.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default version: %w", err)
+	}
+	ok, err := resolver.Satisfies(available, inferred.Version)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+	return &inferred, nil
+}
+
+func execNode(scriptPath string, args []string, env []string) error {
+	cmdArgs := append([]string{scriptPath}, args...)
+
 	nodePath, err := exec.LookPath("node")
 	if err != nil {
 		return fmt.Errorf("node not found in PATH: %w", err)
@@ -0,0 +1,222 @@
+package executor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/defaults"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+func TestResolveDevEngine(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	if err := defaults.UpdateDefault(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "8.15.9"}); err != nil {
+		t.Fatal(err)
+	}
+
+	found := func(engines ...inspector.DevEngine) *inspector.FoundSpec {
+		return &inspector.FoundSpec{
+			PackageJSONPath: "package.json",
+			Spec:            inspector.PackageManagerSpec{Name: engines[0].Name, Version: engines[0].Version},
+			Field:           inspector.FieldDevEngines,
+			DevEngines:      engines,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		found    *inspector.FoundSpec
+		invoked  string
+		expected *inspector.PackageManagerSpec
+		wantErr  error
+	}{
+		{"download resolves range", found(inspector.DevEngine{Name: "pnpm", Version: "^9", OnFail: inspector.OnFailDownload}), "pnpm", &inspector.PackageManagerSpec{Name: "pnpm", Version: "^9"}, nil},
+		{"default satisfies range", found(inspector.DevEngine{Name: "pnpm", Version: "^8", OnFail: inspector.OnFailError}), "pnpm", nil, nil},
+		{"no version uses default", found(inspector.DevEngine{Name: "pnpm", OnFail: inspector.OnFailError}), "pnpm", nil, nil},
+		{"error when unsatisfied", found(inspector.DevEngine{Name: "pnpm", Version: "^9", OnFail: inspector.OnFailError}), "pnpm", nil, &DevEngineError{}},
+		{"warn when unsatisfied", found(inspector.DevEngine{Name: "pnpm", Version: "^9", OnFail: inspector.OnFailWarn}), "pnpm", nil, nil},
+		{"ignore when unsatisfied", found(inspector.DevEngine{Name: "pnpm", Version: "^9", OnFail: inspector.OnFailIgnore}), "pnpm", nil, nil},
+		{"mismatch errors", found(inspector.DevEngine{Name: "yarn", OnFail: inspector.OnFailError}), "pnpm", nil, &SpecMismatchError{}},
+		{"mismatch ignored", found(inspector.DevEngine{Name: "yarn", OnFail: inspector.OnFailIgnore}), "pnpm", nil, nil},
+		{"array picks invoked", found(inspector.DevEngine{Name: "yarn", OnFail: inspector.OnFailError}, inspector.DevEngine{Name: "pnpm", Version: "^9", OnFail: inspector.OnFailDownload}), "pnpm", &inspector.PackageManagerSpec{Name: "pnpm", Version: "^9"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := resolveDevEngine(conf, tt.found, tt.invoked, defaults.GetDefaultVersion)
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("resolveDevEngine() error = %v", err)
+				}
+			case *DevEngineError:
+				if !errors.As(err, &want) {
+					t.Fatalf("expected DevEngineError, got %v", err)
+				}
+			case *SpecMismatchError:
+				if !errors.As(err, &want) {
+					t.Fatalf("expected SpecMismatchError, got %v", err)
+				}
+			}
+			if (spec == nil) != (tt.expected == nil) || (spec != nil && *spec != *tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, spec)
+			}
+		})
+	}
+}
+
+func TestResolveInferred(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	if err := defaults.UpdateDefault(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.12.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version  string
+		expected *inspector.PackageManagerSpec
+	}{
+		{"", nil},
+		{">=9", nil},
+		{"^8", &inspector.PackageManagerSpec{Name: "pnpm", Version: "^8"}},
+	}
+
+	for _, tt := range tests {
+		spec, err := resolveInferred(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: tt.version}, defaults.GetDefaultVersion)
+		if err != nil {
+			t.Fatalf("resolveInferred(%q) error = %v", tt.version, err)
+		}
+		if (spec == nil) != (tt.expected == nil) || (spec != nil && *spec != *tt.expected) {
+			t.Errorf("resolveInferred(%q) = %v, want %v", tt.version, spec, tt.expected)
+		}
+	}
+}
+
+func TestSpecMismatchError_Lockfile(t *testing.T) {
+	err := &SpecMismatchError{Expected: "pnpm", Path: "pnpm-lock.yaml", Field: inspector.FieldLockfile}
+	if !strings.Contains(err.Error(), "Inferred from ./pnpm-lock.yaml") {
+		t.Errorf("expected lockfile hint, got %q", err.Error())
+	}
+}
+
+func TestResolveSpec(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	if err := defaults.UpdateDefault(conf, inspector.PackageManagerSpec{Name: "npm", Version: "10.8.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "package.json"), []byte(`{"packageManager": "pnpm@9.1.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	spec, err := ResolveSpec(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("ResolveSpec() error = %v", err)
+	}
+	if *spec != (inspector.PackageManagerSpec{Name: "pnpm", Version: "9.1.0"}) {
+		t.Errorf("expected pnpm@9.1.0, got %v", spec)
+	}
+
+	var mismatch *SpecMismatchError
+	if _, err := ResolveSpec(conf, "npm"); !errors.As(err, &mismatch) {
+		t.Errorf("expected SpecMismatchError for npm, got %v", err)
+	}
+
+	conf.IgnoreSpecMismatch = true
+	spec, err = ResolveSpec(conf, "npm")
+	if err != nil {
+		t.Fatalf("ResolveSpec() error = %v", err)
+	}
+	if spec.Version != "10.8.0" {
+		t.Errorf("expected default npm@10.8.0, got %v", spec)
+	}
+}
+
+func TestLocalSpec(t *testing.T) {
+	// Nothing listens on port 0, so any registry lookup would fail.
+	conf := &config.Config{PmmDir: t.TempDir(), Registry: "http://127.0.0.1:0", IgnoreSpecMismatch: true}
+	project := t.TempDir()
+	t.Chdir(project)
+
+	tests := []struct {
+		packageJSON string
+		name        string
+		expected    string
+	}{
+		{`{"packageManager": "pnpm@9.1.0"}`, "pnpm", "9.1.0"},
+		{`{"packageManager": "pnpm@^9"}`, "pnpm", ""},
+		{`{"packageManager": "pnpm@9.1.0"}`, "npm", ""},
+		{`{"devEngines": {"packageManager": {"name": "pnpm", "version": "^9"}}}`, "pnpm", ""},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(filepath.Join(project, "package.json"), []byte(tt.packageJSON), 0644); err != nil {
+			t.Fatal(err)
+		}
+		spec, err := LocalSpec(conf, tt.name)
+		if err != nil {
+			t.Fatalf("LocalSpec(%s) in %s error = %v", tt.name, tt.packageJSON, err)
+		}
+		if *spec != (inspector.PackageManagerSpec{Name: tt.name, Version: tt.expected}) {
+			t.Errorf("LocalSpec(%s) in %s = %v, want version %q", tt.name, tt.packageJSON, spec, tt.expected)
+		}
+	}
+	if version := defaults.ReadDefault(conf, "npm"); version != "" {
+		t.Errorf("expected no default to be written, got npm@%s", version)
+	}
+
+	if err := defaults.UpdateDefault(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.4.0"}); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := LocalSpec(conf, "pnpm")
+	if err != nil || spec.Version != "9.4.0" {
+		t.Errorf("expected the default pnpm@9.4.0 to satisfy devEngines, got %v, %v", spec, err)
+	}
+}
+
+func TestProjectYarnPath(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir(), Registry: "http://127.0.0.1:0"}
+	project := t.TempDir()
+	release := filepath.Join(project, ".yarn", "releases", "yarn.cjs")
+	if err := os.MkdirAll(filepath.Dir(release), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(release, []byte("// yarn"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".yarnrc.yml"), []byte("yarnPath: .yarn/releases/yarn.cjs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	// Neither packageManager nor a versioned devEngines entry hides the
+	// checked-in release.
+	for _, pkgJSON := range []string{`{}`, `{"devEngines": {"packageManager": {"name": "yarn"}}}`} {
+		if err := os.WriteFile(filepath.Join(project, "package.json"), []byte(pkgJSON), 0644); err != nil {
+			t.Fatal(err)
+		}
+		spec, found, err := findProjectSpec(conf, "yarn", readDefault)
+		if err != nil || spec != nil {
+			t.Fatalf("findProjectSpec() in %s = %v, %v", pkgJSON, spec, err)
+		}
+		yarnPath, err := projectYarnPath(conf, found)
+		if err != nil || yarnPath != release {
+			t.Errorf("projectYarnPath() in %s = %q, %v, want %q", pkgJSON, yarnPath, err, release)
+		}
+	}
+
+	if err := checkYarnPath(conf, nil, release); err != nil {
+		t.Errorf("checkYarnPath() without a policy error = %v", err)
+	}
+	conf.PolicyFile = filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(conf.PolicyFile, []byte(`{"packageManagers": {"yarn": {"minimum": "4.0.0"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkYarnPath(conf, nil, release); err == nil {
+		t.Error("expected a yarnPath release of unknown version to fail a yarn policy")
+	}
+}
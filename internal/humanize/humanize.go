@@ -0,0 +1,27 @@
+// Package humanize formats quantities for messages and tables.
+package humanize
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration rounds d down to whole days, hours or minutes, e.g. "3 days".
+func Duration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return Plural(int(d/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return Plural(int(d/time.Hour), "hour")
+	default:
+		return Plural(int(d/time.Minute), "minute")
+	}
+}
+
+// Plural counts n of unit, e.g. "1 day" or "2 days".
+func Plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,23 @@
+package humanize
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{10 * time.Second, "0 minutes"},
+		{time.Minute, "1 minute"},
+		{5*time.Hour + 59*time.Minute, "5 hours"},
+		{7 * 24 * time.Hour, "7 days"},
+	}
+	for _, tt := range tests {
+		if got := Duration(tt.d); got != tt.expected {
+			t.Errorf("Duration(%v) = %q, want %q", tt.d, got, tt.expected)
+		}
+	}
+}
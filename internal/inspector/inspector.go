@@ -14,15 +14,87 @@ import (
 type PackageManagerSpec struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
+	// HashAlgorithm and Hash hold the corepack-style "+sha512.<hex>" suffix,
+	// a hex digest of the package manager's archive.
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	Hash          string `json:"hash,omitempty"`
 }
 
+func (s PackageManagerSpec) String() string {
+	if s.Hash == "" {
+		return fmt.Sprintf("%s@%s", s.Name, s.Version)
+	}
+	return fmt.Sprintf("%s@%s+%s.%s", s.Name, s.Version, s.HashAlgorithm, s.Hash)
+}
+
+// The package.json fields a FoundSpec can come from. When both are present,
+// packageManager takes precedence.
+const (
+	FieldPackageManager = "packageManager"
+	FieldDevEngines     = "devEngines.packageManager"
+)
+
+// The devEngines onFail modes. OnFailError is the default.
+const (
+	OnFailIgnore   = "ignore"
+	OnFailWarn     = "warn"
+	OnFailError    = "error"
+	OnFailDownload = "download"
+)
+
 type PackageJSON struct {
 	PackageManager string `json:"packageManager"`
+	DevEngines     struct {
+		PackageManager DevEngineList `json:"packageManager"`
+	} `json:"devEngines"`
+}
+
+// DevEngine is an entry of devEngines.packageManager. Version is a semver
+// range and may be empty.
+type DevEngine struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	OnFail  string `json:"onFail"`
+}
+
+// DevEngineList accepts devEngines.packageManager as a single object or as
+// an array of alternatives.
+type DevEngineList []DevEngine
+
+func (l *DevEngineList) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]DevEngine)(l))
+	}
+	var engine DevEngine
+	if err := json.Unmarshal(data, &engine); err != nil {
+		return err
+	}
+	*l = DevEngineList{engine}
+	return nil
 }
 
 type FoundSpec struct {
 	PackageJSONPath string
 	Spec            PackageManagerSpec
+	// Field is the package.json field that Spec was read from.
+	Field string
+	// DevEngines holds the acceptable package managers when Field is
+	// FieldDevEngines. Spec is the first of them.
+	DevEngines []DevEngine
+	// LockfilePath is set when Field is FieldLockfile. Spec.Version is then
+	// a range of compatible versions, or empty.
+	LockfilePath string
+}
+
+// DevEngine returns the devEngines entry for the named package manager, or
+// nil if the project doesn't allow it.
+func (f *FoundSpec) DevEngine(name string) *DevEngine {
+	for i := range f.DevEngines {
+		if f.DevEngines[i].Name == name {
+			return &f.DevEngines[i]
+		}
+	}
+	return nil
 }
 
 func ParseSpecString(specString string) (PackageManagerSpec, error) {
@@ -33,8 +105,17 @@ func ParseSpecString(specString string) (PackageManagerSpec, error) {
 
 	name := parts[0]
 	version := parts[1]
+	var hashAlgorithm, hash string
 	if shaIdx := strings.Index(version, "+sha"); shaIdx != -1 {
+		suffix := version[shaIdx+1:]
 		version = version[:shaIdx]
+
+		var ok bool
+		hashAlgorithm, hash, ok = strings.Cut(suffix, ".")
+		if !ok || !isHex(hash) {
+			return PackageManagerSpec{}, fmt.Errorf("invalid hash in spec: %s", specString)
+		}
+		hash = strings.ToLower(hash)
 	}
 
 	if !config.IsSupported(name) {
@@ -42,12 +123,29 @@ func ParseSpecString(specString string) (PackageManagerSpec, error) {
 	}
 
 	return PackageManagerSpec{
-		Name:    name,
-		Version: version,
+		Name:          name,
+		Version:       version,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          hash,
 	}, nil
 }
 
-func FindPackageManagerSpec() (*FoundSpec, error) {
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindPackageManagerSpec climbs from the working directory to the nearest
+// package.json that names a package manager. With conf.InferFromLockfile, a
+// package.json without one falls back to the lockfile next to it.
+func FindPackageManagerSpec(conf *config.Config) (*FoundSpec, error) {
 	current, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get working directory: %w", err)
@@ -56,15 +154,18 @@ func FindPackageManagerSpec() (*FoundSpec, error) {
 	for {
 		pkgJSONPath := filepath.Join(current, "package.json")
 		if _, err := os.Stat(pkgJSONPath); err == nil {
-			spec, err := loadSpecFromPkgJSON(pkgJSONPath)
+			found, err := loadSpecFromPkgJSON(pkgJSONPath)
 			if err != nil {
 				return nil, fmt.Errorf("failed to load spec from %s: %w", pkgJSONPath, err)
 			}
-			if spec != nil {
-				return &FoundSpec{
-					PackageJSONPath: pkgJSONPath,
-					Spec:            *spec,
-				}, nil
+			if found == nil && conf.InferFromLockfile {
+				found, err = inferFromLockfile(pkgJSONPath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to infer spec from lockfile in %s: %w", current, err)
+				}
+			}
+			if found != nil {
+				return found, nil
 			}
 		}
 
@@ -78,7 +179,36 @@ func FindPackageManagerSpec() (*FoundSpec, error) {
 	return nil, nil
 }
 
-func loadSpecFromPkgJSON(path string) (*PackageManagerSpec, error) {
+// FindProjectPackageJSON returns the package.json that configures the
+// project in the working directory: the one that names a package manager,
+// or else the nearest one.
+func FindProjectPackageJSON(conf *config.Config) (string, error) {
+	found, err := FindPackageManagerSpec(conf)
+	if err != nil {
+		return "", err
+	}
+	if found != nil {
+		return found.PackageJSONPath, nil
+	}
+
+	current, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	for {
+		pkgJSONPath := filepath.Join(current, "package.json")
+		if _, err := os.Stat(pkgJSONPath); err == nil {
+			return pkgJSONPath, nil
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", fmt.Errorf("no package.json found in the current directory or its parents")
+		}
+		current = parent
+	}
+}
+
+func loadSpecFromPkgJSON(path string) (*FoundSpec, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -89,16 +219,58 @@ func loadSpecFromPkgJSON(path string) (*PackageManagerSpec, error) {
 		return nil, err
 	}
 
-	if pkg.PackageManager == "" {
+	if pkg.PackageManager != "" {
+		spec, err := ParseSpecString(pkg.PackageManager)
+		if err != nil {
+			return nil, err
+		}
+		return &FoundSpec{PackageJSONPath: path, Spec: spec, Field: FieldPackageManager}, nil
+	}
+
+	var engines []DevEngine
+	for _, engine := range pkg.DevEngines.PackageManager {
+		if !config.IsSupported(engine.Name) {
+			continue
+		}
+		switch engine.OnFail {
+		case OnFailIgnore, OnFailWarn, OnFailError, OnFailDownload:
+		default:
+			engine.OnFail = OnFailError
+		}
+		engines = append(engines, engine)
+	}
+	if len(engines) == 0 {
 		return nil, nil
 	}
 
-	spec, err := ParseSpecString(pkg.PackageManager)
+	return &FoundSpec{
+		PackageJSONPath: path,
+		Spec:            PackageManagerSpec{Name: engines[0].Name, Version: engines[0].Version},
+		Field:           FieldDevEngines,
+		DevEngines:      engines,
+	}, nil
+}
+
+// ReadEngines returns the engines field of the package.json at path. An
+// engines field that isn't an object of ranges is treated as absent.
+func ReadEngines(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return &spec, nil
+	var pkg struct {
+		Engines json.RawMessage `json:"engines"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+
+	var engines map[string]string
+	if err := json.Unmarshal(pkg.Engines, &engines); err != nil {
+		return nil, nil
+	}
+	return engines, nil
 }
 
 func UpdateSpecInPackageJSON(path string, spec PackageManagerSpec) error {
@@ -108,7 +280,7 @@ func UpdateSpecInPackageJSON(path string, spec PackageManagerSpec) error {
 	}
 
 	jsonStr := string(data)
-	value := fmt.Sprintf("%s@%s", spec.Name, spec.Version)
+	value := spec.String()
 
 	// sjson.Set preserves formatting and order
 	newJSON, err := sjson.Set(jsonStr, "packageManager", value)
@@ -3,7 +3,10 @@ package inspector
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
 )
 
 func TestParseSpecString(t *testing.T) {
@@ -12,13 +15,15 @@ func TestParseSpecString(t *testing.T) {
 		expected PackageManagerSpec
 		wantErr  bool
 	}{
-		{"pnpm@8.0.0", PackageManagerSpec{"pnpm", "8.0.0"}, false},
-		{"npm@6.14.15", PackageManagerSpec{"npm", "6.14.15"}, false},
-		{"yarn@1.22.19", PackageManagerSpec{"yarn", "1.22.19"}, false},
-		{"yarn@3.2.3+sha224.953c8233f7a92884eee2de69a1b92d1f2ec1655e66d08071ba9a02fa", PackageManagerSpec{"yarn", "3.2.3"}, false},
+		{"pnpm@8.0.0", PackageManagerSpec{Name: "pnpm", Version: "8.0.0"}, false},
+		{"npm@6.14.15", PackageManagerSpec{Name: "npm", Version: "6.14.15"}, false},
+		{"yarn@1.22.19", PackageManagerSpec{Name: "yarn", Version: "1.22.19"}, false},
+		{"yarn@3.2.3+sha224.953c8233f7a92884eee2de69a1b92d1f2ec1655e66d08071ba9a02fa", PackageManagerSpec{Name: "yarn", Version: "3.2.3", HashAlgorithm: "sha224", Hash: "953c8233f7a92884eee2de69a1b92d1f2ec1655e66d08071ba9a02fa"}, false},
+		{"pnpm@9.0.0+sha512.ZZZZ", PackageManagerSpec{}, true},
+		{"pnpm@9.0.0+sha512", PackageManagerSpec{}, true},
 		{"invalid", PackageManagerSpec{}, true},
-		{"pnpm@latest", PackageManagerSpec{"pnpm", "latest"}, false},
-		{"bun@1.0.0", PackageManagerSpec{"bun", "1.0.0"}, false},
+		{"pnpm@latest", PackageManagerSpec{Name: "pnpm", Version: "latest"}, false},
+		{"bun@1.0.0", PackageManagerSpec{Name: "bun", Version: "1.0.0"}, false},
 	}
 
 	for _, tt := range tests {
@@ -48,9 +53,9 @@ func TestFindPackageManagerSpec(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	found, err := FindPackageManagerSpec()
+	found, err := FindPackageManagerSpec(&config.Config{})
 	if err != nil {
-		t.Fatalf("FindPackageManagerSpec() error = %v", err)
+		t.Fatalf("FindPackageManagerSpec(&config.Config{}) error = %v", err)
 	}
 	if found == nil {
 		t.Fatal("expected to find spec, got nil")
@@ -75,9 +80,9 @@ func TestFindPackageManagerSpec_WithSHASuffix(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	found, err := FindPackageManagerSpec()
+	found, err := FindPackageManagerSpec(&config.Config{})
 	if err != nil {
-		t.Fatalf("FindPackageManagerSpec() error = %v", err)
+		t.Fatalf("FindPackageManagerSpec(&config.Config{}) error = %v", err)
 	}
 	if found == nil {
 		t.Fatal("expected to find spec, got nil")
@@ -85,4 +90,134 @@ func TestFindPackageManagerSpec_WithSHASuffix(t *testing.T) {
 	if found.Spec.Name != "yarn" || found.Spec.Version != "3.2.3" {
 		t.Errorf("expected yarn@3.2.3, got %s@%s", found.Spec.Name, found.Spec.Version)
 	}
+	if found.Spec.HashAlgorithm != "sha224" || found.Spec.Hash != "953c8233f7a92884eee2de69a1b92d1f2ec1655e66d08071ba9a02fa" {
+		t.Errorf("expected sha224 hash to be kept, got %s.%s", found.Spec.HashAlgorithm, found.Spec.Hash)
+	}
+}
+
+func TestFindPackageManagerSpec_DevEngines(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		field    string
+		expected PackageManagerSpec
+		engines  []DevEngine
+	}{
+		{
+			"object",
+			`{"devEngines": {"packageManager": {"name": "pnpm", "version": "^9", "onFail": "download"}}}`,
+			FieldDevEngines,
+			PackageManagerSpec{Name: "pnpm", Version: "^9"},
+			[]DevEngine{{Name: "pnpm", Version: "^9", OnFail: OnFailDownload}},
+		},
+		{
+			"array with default onFail",
+			`{"devEngines": {"packageManager": [{"name": "deno"}, {"name": "pnpm", "version": "^9"}, {"name": "yarn", "onFail": "warn"}]}}`,
+			FieldDevEngines,
+			PackageManagerSpec{Name: "pnpm", Version: "^9"},
+			[]DevEngine{{Name: "pnpm", Version: "^9", OnFail: OnFailError}, {Name: "yarn", OnFail: OnFailWarn}},
+		},
+		{
+			"packageManager takes precedence",
+			`{"packageManager": "pnpm@9.1.0", "devEngines": {"packageManager": {"name": "yarn"}}}`,
+			FieldPackageManager,
+			PackageManagerSpec{Name: "pnpm", Version: "9.1.0"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, "package.json"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			oldWd, _ := os.Getwd()
+			defer os.Chdir(oldWd)
+			if err := os.Chdir(tmpDir); err != nil {
+				t.Fatal(err)
+			}
+
+			found, err := FindPackageManagerSpec(&config.Config{})
+			if err != nil {
+				t.Fatalf("FindPackageManagerSpec(&config.Config{}) error = %v", err)
+			}
+			if found == nil {
+				t.Fatal("expected to find spec, got nil")
+			}
+			if found.Field != tt.field || found.Spec != tt.expected {
+				t.Errorf("expected %s from %s, got %s from %s", tt.expected, tt.field, found.Spec, found.Field)
+			}
+			if len(found.DevEngines) != len(tt.engines) {
+				t.Fatalf("expected engines %v, got %v", tt.engines, found.DevEngines)
+			}
+			for i := range tt.engines {
+				if found.DevEngines[i] != tt.engines[i] {
+					t.Errorf("expected engine %v, got %v", tt.engines[i], found.DevEngines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFindProjectPackageJSON(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "packages", "app")
+	if err := os.MkdirAll(app, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "package.json"), []byte(`{"private": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(app, "package.json"), []byte(`{"name": "app"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(app)
+
+	path, err := FindProjectPackageJSON(&config.Config{})
+	if err != nil {
+		t.Fatalf("FindProjectPackageJSON() error = %v", err)
+	}
+	if path != filepath.Join(app, "package.json") {
+		t.Errorf("expected nearest package.json without a packageManager, got %s", path)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "package.json"), []byte(`{"packageManager": "pnpm@9.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err = FindProjectPackageJSON(&config.Config{})
+	if err != nil {
+		t.Fatalf("FindProjectPackageJSON() error = %v", err)
+	}
+	if path != filepath.Join(root, "package.json") {
+		t.Errorf("expected the package.json naming a package manager, got %s", path)
+	}
+}
+
+func TestReadEngines(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		content  string
+		expected map[string]string
+	}{
+		{`{"engines": {"node": ">=18", "pnpm": "^9"}}`, map[string]string{"node": ">=18", "pnpm": "^9"}},
+		{`{"name": "app"}`, nil},
+		{`{"engines": ["node >= 0.8"]}`, nil},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(tmpDir, "package.json")
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadEngines(path)
+		if err != nil {
+			t.Errorf("ReadEngines(%s) error = %v", tt.content, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ReadEngines(%s) = %v, want %v", tt.content, got, tt.expected)
+		}
+	}
 }
@@ -0,0 +1,144 @@
+package inspector
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// FieldLockfile marks a FoundSpec that was inferred from a lockfile rather
+// than read from package.json.
+const FieldLockfile = "lockfile"
+
+// lockfileVersions are only looked for near the top of the file, so huge
+// lockfiles are never read in full.
+const lockfilePrefixSize = 4096
+
+type lockfile struct {
+	name string
+	file string
+	// versionRange maps the head of the lockfile to the range of package
+	// manager versions that write that format, or "" if it can't tell.
+	versionRange func(head []byte) string
+}
+
+var lockfiles = []lockfile{
+	{"pnpm", "pnpm-lock.yaml", pnpmLockRange},
+	{"yarn", "yarn.lock", yarnLockRange},
+	{"npm", "package-lock.json", npmLockRange},
+	{"npm", "npm-shrinkwrap.json", npmLockRange},
+	{"bun", "bun.lock", func([]byte) string { return ">=1.2" }},
+	{"bun", "bun.lockb", func([]byte) string { return "" }},
+}
+
+var (
+	pnpmLockVersionRe = regexp.MustCompile(`(?m)^lockfileVersion:\s*'?"?(\d+)\.(\d+)`)
+	yarnLockVersionRe = regexp.MustCompile(`(?m)^__metadata:\s*\n(?:[ \t]+.*\n)*?[ \t]+version:\s*(\d+)`)
+	npmLockVersionRe  = regexp.MustCompile(`"lockfileVersion":\s*(\d+)`)
+)
+
+func pnpmLockRange(head []byte) string {
+	match := pnpmLockVersionRe.FindSubmatch(head)
+	if match == nil {
+		return ""
+	}
+	switch major, minor := string(match[1]), string(match[2]); {
+	case major == "9":
+		return ">=9"
+	case major == "6":
+		return "^8"
+	case major == "5" && minor == "4":
+		return "^7"
+	case major == "5" && minor == "3":
+		return "^6"
+	}
+	return ""
+}
+
+func yarnLockRange(head []byte) string {
+	if !bytes.Contains(head, []byte("__metadata:")) {
+		return "^1"
+	}
+	match := yarnLockVersionRe.FindSubmatch(head)
+	if match == nil {
+		return ">=2"
+	}
+	switch string(match[1]) {
+	case "4":
+		return "^2"
+	case "5", "6":
+		return "^3"
+	}
+	return ">=4"
+}
+
+func npmLockRange(head []byte) string {
+	match := npmLockVersionRe.FindSubmatch(head)
+	if match == nil {
+		return ""
+	}
+	switch string(match[1]) {
+	case "1":
+		return "^5 || ^6"
+	case "2":
+		return ">=7 <9"
+	case "3":
+		return ">=9"
+	}
+	return ""
+}
+
+// inferFromLockfile picks the package manager for dir from its lockfile.
+// It returns nil when there is no lockfile, or when lockfiles of different
+// package managers make the choice ambiguous.
+func inferFromLockfile(pkgJSONPath string) (*FoundSpec, error) {
+	dir := filepath.Dir(pkgJSONPath)
+
+	var found *FoundSpec
+	for _, lf := range lockfiles {
+		path := filepath.Join(dir, lf.file)
+		head, err := readHead(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if found != nil {
+			if found.Spec.Name != lf.name {
+				return nil, nil
+			}
+			continue
+		}
+		found = &FoundSpec{
+			PackageJSONPath: pkgJSONPath,
+			Spec:            PackageManagerSpec{Name: lf.name, Version: lf.versionRange(head)},
+			Field:           FieldLockfile,
+			LockfilePath:    path,
+		}
+	}
+	return found, nil
+}
+
+func readHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head, err := io.ReadAll(io.LimitReader(f, lockfilePrefixSize))
+	if err != nil {
+		return nil, err
+	}
+	// Drop a partial last line so patterns never match a truncated value.
+	if len(head) == lockfilePrefixSize {
+		if idx := bytes.LastIndexByte(head, '\n'); idx != -1 {
+			head = head[:idx+1]
+		}
+	}
+	return head, nil
+}
@@ -0,0 +1,92 @@
+package inspector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+)
+
+func TestInferFromLockfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected *PackageManagerSpec
+	}{
+		{"pnpm 9", map[string]string{"pnpm-lock.yaml": "lockfileVersion: '9.0'\n\nsettings:\n"}, &PackageManagerSpec{Name: "pnpm", Version: ">=9"}},
+		{"pnpm 8", map[string]string{"pnpm-lock.yaml": "lockfileVersion: '6.0'\n"}, &PackageManagerSpec{Name: "pnpm", Version: "^8"}},
+		{"pnpm 7", map[string]string{"pnpm-lock.yaml": "lockfileVersion: 5.4\n"}, &PackageManagerSpec{Name: "pnpm", Version: "^7"}},
+		{"yarn classic", map[string]string{"yarn.lock": "# THIS IS AN AUTOGENERATED FILE.\n# yarn lockfile v1\n"}, &PackageManagerSpec{Name: "yarn", Version: "^1"}},
+		{"yarn 4", map[string]string{"yarn.lock": "# This file is generated by running \"yarn install\"\n\n__metadata:\n  version: 8\n  cacheKey: 10c0\n"}, &PackageManagerSpec{Name: "yarn", Version: ">=4"}},
+		{"yarn 3", map[string]string{"yarn.lock": "__metadata:\n  version: 6\n  cacheKey: 8\n"}, &PackageManagerSpec{Name: "yarn", Version: "^3"}},
+		{"npm 9", map[string]string{"package-lock.json": "{\n  \"name\": \"app\",\n  \"lockfileVersion\": 3,\n"}, &PackageManagerSpec{Name: "npm", Version: ">=9"}},
+		{"npm 7", map[string]string{"package-lock.json": "{\n  \"lockfileVersion\": 2\n}"}, &PackageManagerSpec{Name: "npm", Version: ">=7 <9"}},
+		{"bun binary", map[string]string{"bun.lockb": "\x00"}, &PackageManagerSpec{Name: "bun"}},
+		{"bun text", map[string]string{"bun.lock": "{}"}, &PackageManagerSpec{Name: "bun", Version: ">=1.2"}},
+		{"same manager twice", map[string]string{"bun.lock": "{}", "bun.lockb": "\x00"}, &PackageManagerSpec{Name: "bun", Version: ">=1.2"}},
+		{"ambiguous", map[string]string{"pnpm-lock.yaml": "lockfileVersion: '9.0'\n", "yarn.lock": ""}, nil},
+		{"none", map[string]string{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			found, err := inferFromLockfile(filepath.Join(tmpDir, "package.json"))
+			if err != nil {
+				t.Fatalf("inferFromLockfile() error = %v", err)
+			}
+			if tt.expected == nil {
+				if found != nil {
+					t.Errorf("expected nothing to be inferred, got %s", found.Spec)
+				}
+				return
+			}
+			if found == nil {
+				t.Fatalf("expected %s, got nil", tt.expected)
+			}
+			if found.Spec != *tt.expected || found.Field != FieldLockfile {
+				t.Errorf("expected %s from lockfile, got %s from %s", tt.expected, found.Spec, found.Field)
+			}
+		})
+	}
+}
+
+func TestFindPackageManagerSpec_InferFromLockfile(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "package.json"), []byte(`{"name": "app"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(tmpDir, "pnpm-lock.yaml")
+	if err := os.WriteFile(lockPath, []byte("lockfileVersion: '9.0'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldWd, _ := os.Getwd()
+	defer os.Chdir(oldWd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := FindPackageManagerSpec(&config.Config{})
+	if err != nil || found != nil {
+		t.Fatalf("expected no spec without inference, got %v, %v", found, err)
+	}
+
+	found, err = FindPackageManagerSpec(&config.Config{InferFromLockfile: true})
+	if err != nil {
+		t.Fatalf("FindPackageManagerSpec() error = %v", err)
+	}
+	if found == nil || found.Spec.Name != "pnpm" {
+		t.Fatalf("expected pnpm to be inferred, got %v", found)
+	}
+	if found.LockfilePath != lockPath {
+		t.Errorf("expected lockfile %s, got %s", lockPath, found.LockfilePath)
+	}
+}
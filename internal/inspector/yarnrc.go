@@ -0,0 +1,59 @@
+package inspector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+type YarnRC struct {
+	YarnPath string `yaml:"yarnPath"`
+}
+
+var yarnReleaseRe = regexp.MustCompile(`yarn-(\d+\.\d+\.\d+[^/]*?)\.c?js$`)
+
+// FindYarnPath returns the absolute path of the release that .yarnrc.yml
+// (next to pkgJSONPath) points yarnPath at, or "" if it sets none.
+func FindYarnPath(pkgJSONPath string) (string, error) {
+	dir := filepath.Dir(pkgJSONPath)
+	rcPath := filepath.Join(dir, ".yarnrc.yml")
+
+	data, err := os.ReadFile(rcPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var rc YarnRC
+	if err := yaml.Unmarshal(data, &rc); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", rcPath, err)
+	}
+	if rc.YarnPath == "" {
+		return "", nil
+	}
+
+	yarnPath := rc.YarnPath
+	if !filepath.IsAbs(yarnPath) {
+		yarnPath = filepath.Join(dir, yarnPath)
+	}
+	if _, err := os.Stat(yarnPath); err != nil {
+		return "", fmt.Errorf("yarnPath %s from %s not found", rc.YarnPath, rcPath)
+	}
+
+	return yarnPath, nil
+}
+
+// YarnPathVersion extracts the version from a release file name such as
+// .yarn/releases/yarn-4.1.0.cjs, returning "" if it doesn't follow that form.
+func YarnPathVersion(yarnPath string) string {
+	match := yarnReleaseRe.FindStringSubmatch(filepath.Base(yarnPath))
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
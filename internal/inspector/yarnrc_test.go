@@ -0,0 +1,60 @@
+package inspector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindYarnPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	pkgJSONPath := filepath.Join(tmpDir, "package.json")
+
+	yarnPath, err := FindYarnPath(pkgJSONPath)
+	if err != nil || yarnPath != "" {
+		t.Fatalf("FindYarnPath() without .yarnrc.yml = %q, %v; want \"\", nil", yarnPath, err)
+	}
+
+	rc := "nodeLinker: node-modules\nyarnPath: .yarn/releases/yarn-4.1.0.cjs\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ".yarnrc.yml"), []byte(rc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FindYarnPath(pkgJSONPath); err == nil {
+		t.Error("expected error for missing yarnPath release, got nil")
+	}
+
+	release := filepath.Join(tmpDir, ".yarn", "releases", "yarn-4.1.0.cjs")
+	if err := os.MkdirAll(filepath.Dir(release), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(release, []byte("// yarn"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	yarnPath, err = FindYarnPath(pkgJSONPath)
+	if err != nil {
+		t.Fatalf("FindYarnPath() error = %v", err)
+	}
+	if yarnPath != release {
+		t.Errorf("expected %s, got %s", release, yarnPath)
+	}
+}
+
+func TestYarnPathVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{".yarn/releases/yarn-4.1.0.cjs", "4.1.0"},
+		{".yarn/releases/yarn-3.6.4.js", "3.6.4"},
+		{".yarn/releases/yarn-4.0.0-rc.53.cjs", "4.0.0-rc.53"},
+		{".yarn/releases/yarn-berry.cjs", ""},
+	}
+
+	for _, tt := range tests {
+		if got := YarnPathVersion(tt.input); got != tt.expected {
+			t.Errorf("YarnPathVersion(%s) = %q; want %q", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package installer
+
+// Unexported internals for the tests in installer_test, which share their
+// fixtures with other packages through installertest.
+var (
+	ExtractTarGz        = extractTarGz
+	ExtractZip          = extractZip
+	ReadCompleteMarker  = readCompleteMarker
+	WriteCompleteMarker = writeCompleteMarker
+)
+
+const (
+	StagingPrefix   = stagingPrefix
+	StaleStagingAge = staleStagingAge
+)
@@ -0,0 +1,249 @@
+package installer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ErrUnsafeArchive is returned for archive entries that would be written, or
+// link to, somewhere outside the install directory.
+var ErrUnsafeArchive = errors.New("unsafe archive entry")
+
+// maxLinkTarget bounds how much of a zip entry is read as a symlink target.
+const maxLinkTarget = 4096
+
+// extractor writes archive entries below dest. Entry names have their first
+// component stripped, since npm tarballs nest everything under "package/" and
+// bun zips under "bun-<os>-<arch>/".
+type extractor struct {
+	dest string
+	// symlinks holds the relative paths of symlinks created so far. Entries
+	// are never written through them, so a link can't be used to escape dest.
+	symlinks map[string]bool
+}
+
+func newExtractor(dest string) *extractor {
+	return &extractor{dest: dest, symlinks: map[string]bool{}}
+}
+
+// resolve maps an archive entry name to its path relative to dest. It
+// returns "" for entries that should be skipped.
+func (x *extractor) resolve(name string) (string, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) <= 1 {
+		return "", nil
+	}
+	rel := path.Join(parts[1:]...)
+	if rel == "." || rel == "" {
+		return "", nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf("%w: %s escapes the install directory", ErrUnsafeArchive, name)
+	}
+
+	for dir := rel; dir != "."; dir = path.Dir(dir) {
+		if x.symlinks[dir] {
+			return "", fmt.Errorf("%w: %s is written through symlink %s", ErrUnsafeArchive, name, dir)
+		}
+	}
+	return rel, nil
+}
+
+func (x *extractor) path(rel string) string {
+	return filepath.Join(x.dest, filepath.FromSlash(rel))
+}
+
+func (x *extractor) dir(rel string) error {
+	return os.MkdirAll(x.path(rel), 0755)
+}
+
+func (x *extractor) file(rel string, mode os.FileMode, r io.Reader) error {
+	target := x.path(rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Perm drops setuid, setgid and sticky bits. O_NOFOLLOW refuses to write
+	// through a symlink that is already at target.
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|syscall.O_NOFOLLOW, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (x *extractor) symlink(rel, linkname string) error {
+	target := x.path(rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := x.checkLinkTarget(rel, linkname); err != nil {
+		return err
+	}
+	if err := os.Symlink(linkname, target); err != nil {
+		return err
+	}
+	x.symlinks[rel] = true
+	return nil
+}
+
+// checkLinkTarget walks linkname the way the kernel will. Cleaning the path
+// first would be wrong: "a/../x" is "x" as text, but resolves through a, which
+// may itself be a symlink. So every directory that a ".." climbs out of must
+// already exist as a real directory; those can't be replaced by a symlink
+// later in the archive.
+func (x *extractor) checkLinkTarget(rel, linkname string) error {
+	escapes := fmt.Errorf("%w: symlink %s -> %s escapes the install directory", ErrUnsafeArchive, rel, linkname)
+	if filepath.IsAbs(linkname) {
+		return escapes
+	}
+
+	current := path.Dir(rel)
+	for _, part := range strings.Split(linkname, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if current == "." {
+				return escapes
+			}
+			info, err := os.Lstat(x.path(current))
+			if err != nil || !info.IsDir() {
+				return fmt.Errorf("%w: symlink %s -> %s climbs out of %s, which is not a directory", ErrUnsafeArchive, rel, linkname, current)
+			}
+			current = path.Dir(current)
+		default:
+			current = path.Join(current, part)
+		}
+	}
+	return nil
+}
+
+// hardlink links rel to another entry of the same archive, named by linkname.
+func (x *extractor) hardlink(rel, linkname string) error {
+	linkRel, err := x.resolve(linkname)
+	if err != nil {
+		return err
+	}
+	if linkRel == "" {
+		return fmt.Errorf("%w: hardlink %s -> %s has no target", ErrUnsafeArchive, rel, linkname)
+	}
+
+	target := x.path(rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Link(x.path(linkRel), target)
+}
+
+func extractTarGz(gzipStream io.Reader, dest string) error {
+	uncompressedStream, err := gzip.NewReader(gzipStream)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(uncompressedStream)
+	x := newExtractor(dest)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := x.resolve(header.Name)
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(rel)
+		case tar.TypeReg:
+			err = x.file(rel, header.FileInfo().Mode(), tarReader)
+		case tar.TypeSymlink:
+			err = x.symlink(rel, header.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(rel, header.Linkname)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZip(idx io.ReaderAt, size int64, dest string) error {
+	r, err := zip.NewReader(idx, size)
+	if err != nil {
+		return err
+	}
+
+	x := newExtractor(dest)
+	for _, f := range r.File {
+		rel, err := x.resolve(f.Name)
+		if err != nil {
+			return err
+		}
+		if rel == "" {
+			continue
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.dir(rel)
+		case mode&os.ModeSymlink != 0:
+			err = extractZipSymlink(x, rel, f)
+		case mode.IsRegular():
+			err = extractZipFile(x, rel, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractZipFile(x *extractor, rel string, f *zip.File) error {
+	fileInArchive, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer fileInArchive.Close()
+	return x.file(rel, f.Mode(), fileInArchive)
+}
+
+// extractZipSymlink creates a symlink entry, whose content is the link target.
+func extractZipSymlink(x *extractor, rel string, f *zip.File) error {
+	fileInArchive, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer fileInArchive.Close()
+
+	linkname, err := io.ReadAll(io.LimitReader(fileInArchive, maxLinkTarget))
+	if err != nil {
+		return err
+	}
+	return x.symlink(rel, string(linkname))
+}
@@ -0,0 +1,209 @@
+package installer_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+)
+
+// extractInSandbox extracts into <tmp>/dest, so that anything written next
+// to dest shows up as an escape.
+func extractInSandbox(t *testing.T, archive []byte) (string, error) {
+	t.Helper()
+	sandbox := t.TempDir()
+	dest := filepath.Join(sandbox, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := installer.ExtractTarGz(bytes.NewReader(archive), dest)
+	assertContained(t, sandbox, dest)
+	return dest, err
+}
+
+func assertContained(t testing.TB, sandbox, dest string) {
+	t.Helper()
+	entries, err := os.ReadDir(sandbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "dest" {
+			t.Errorf("archive wrote outside dest: %s", entry.Name())
+		}
+	}
+
+	realDest, _ := filepath.EvalSymlinks(dest)
+	filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			return nil
+		}
+		if rel, err := filepath.Rel(realDest, resolved); err != nil || !filepath.IsLocal(rel) {
+			t.Errorf("symlink %s resolves outside dest: %s", p, resolved)
+		}
+		return nil
+	})
+}
+
+func TestExtractTarGz_Adversarial(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []installertest.TarEntry
+	}{
+		{"parent traversal", []installertest.TarEntry{
+			{Name: "package/../evil", Typeflag: tar.TypeReg, Content: "x"},
+		}},
+		{"deep parent traversal", []installertest.TarEntry{
+			{Name: "package/a/../../../evil", Typeflag: tar.TypeReg, Content: "x"},
+		}},
+		{"absolute symlink", []installertest.TarEntry{
+			{Name: "package/link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		}},
+		{"escaping symlink", []installertest.TarEntry{
+			{Name: "package/a/link", Typeflag: tar.TypeSymlink, Linkname: "../../evil"},
+		}},
+		{"write through symlink", []installertest.TarEntry{
+			{Name: "package/sub/", Typeflag: tar.TypeDir},
+			{Name: "package/link", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+			{Name: "package/link/evil", Typeflag: tar.TypeReg, Content: "x"},
+		}},
+		{"chained symlinks", []installertest.TarEntry{
+			{Name: "package/d/e", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "package/d/e/f", Typeflag: tar.TypeSymlink, Linkname: "../evil"},
+		}},
+		{"symlink through earlier symlink", []installertest.TarEntry{
+			{Name: "package/a", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "package/b", Typeflag: tar.TypeSymlink, Linkname: "a/../evil"},
+		}},
+		{"symlink through later symlink", []installertest.TarEntry{
+			{Name: "package/b", Typeflag: tar.TypeSymlink, Linkname: "a/../evil"},
+			{Name: "package/a", Typeflag: tar.TypeSymlink, Linkname: "."},
+		}},
+		{"overwrite symlink", []installertest.TarEntry{
+			{Name: "package/link", Typeflag: tar.TypeSymlink, Linkname: "file"},
+			{Name: "package/link", Typeflag: tar.TypeReg, Content: "x"},
+		}},
+		{"escaping hardlink", []installertest.TarEntry{
+			{Name: "package/link", Typeflag: tar.TypeLink, Linkname: "package/../../etc/passwd"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extractInSandbox(t, installertest.TarGz(t, tt.entries))
+			if !errors.Is(err, installer.ErrUnsafeArchive) {
+				t.Errorf("expected installer.ErrUnsafeArchive, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractTarGz_Links(t *testing.T) {
+	dest, err := extractInSandbox(t, installertest.TarGz(t, []installertest.TarEntry{
+		{Name: "package/dist/pnpm.cjs", Typeflag: tar.TypeReg, Content: "pnpm", Mode: 0755},
+		{Name: "package/bin/pnpm", Typeflag: tar.TypeSymlink, Linkname: "../dist/pnpm.cjs"},
+		{Name: "package/bin/pnpx", Typeflag: tar.TypeLink, Linkname: "package/dist/pnpm.cjs"},
+	}))
+	if err != nil {
+		t.Fatalf("installer.ExtractTarGz() error = %v", err)
+	}
+
+	for _, name := range []string{"bin/pnpm", "bin/pnpx"} {
+		content, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil || string(content) != "pnpm" {
+			t.Errorf("expected %s to link to dist/pnpm.cjs, got %q, %v", name, content, err)
+		}
+	}
+}
+
+func TestExtractTarGz_StripsSetuid(t *testing.T) {
+	dest, err := extractInSandbox(t, installertest.TarGz(t, []installertest.TarEntry{
+		{Name: "package/bin/tool", Typeflag: tar.TypeReg, Content: "x", Mode: 04755},
+	}))
+	if err != nil {
+		t.Fatalf("installer.ExtractTarGz() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "bin", "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		t.Errorf("expected setuid bit to be stripped, got %s", info.Mode())
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("expected executable bit to be kept, got %s", info.Mode())
+	}
+}
+
+func TestExtractZip_Adversarial(t *testing.T) {
+	build := func(name string, mode os.FileMode, content string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		hdr := &zip.FileHeader{Name: name}
+		hdr.SetMode(mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"parent traversal", build("bun-linux-x64/../../evil", 0644, "x")},
+		{"escaping symlink", build("bun-linux-x64/bun", os.ModeSymlink|0777, "../../evil")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := t.TempDir()
+			dest := filepath.Join(sandbox, "dest")
+			os.Mkdir(dest, 0755)
+			err := installer.ExtractZip(bytes.NewReader(tt.archive), int64(len(tt.archive)), dest)
+			if !errors.Is(err, installer.ErrUnsafeArchive) {
+				t.Errorf("expected installer.ErrUnsafeArchive, got %v", err)
+			}
+			assertContained(t, sandbox, dest)
+		})
+	}
+}
+
+func FuzzExtractTarGz(f *testing.F) {
+	f.Add(installertest.TarGz(f, []installertest.TarEntry{
+		{Name: "package/package.json", Typeflag: tar.TypeReg, Content: "{}"},
+		{Name: "package/bin/pnpm", Typeflag: tar.TypeSymlink, Linkname: "../package.json"},
+		{Name: "package/bin/pnpx", Typeflag: tar.TypeLink, Linkname: "package/package.json"},
+	}))
+	f.Add(installertest.TarGz(f, []installertest.TarEntry{
+		{Name: "package/d/e", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "package/d/e/f", Typeflag: tar.TypeSymlink, Linkname: "../evil"},
+	}))
+
+	f.Fuzz(func(t *testing.T, archive []byte) {
+		sandbox := t.TempDir()
+		dest := filepath.Join(sandbox, "dest")
+		if err := os.Mkdir(dest, 0755); err != nil {
+			t.Fatal(err)
+		}
+		// Errors are expected for most inputs; what matters is that nothing
+		// lands outside dest either way.
+		installer.ExtractTarGz(bytes.NewReader(archive), dest)
+		assertContained(t, sandbox, dest)
+	})
+}
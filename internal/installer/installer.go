@@ -1,17 +1,14 @@
 package installer
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"bytes"
-	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
+	"sync"
 
 	"github.com/ehyland/pmm2/internal/config"
 	"github.com/ehyland/pmm2/internal/inspector"
@@ -27,97 +24,169 @@ func GetInstallPath(conf *config.Config, spec inspector.PackageManagerSpec) stri
 	return filepath.Join(conf.PmmDir, "installed-versions", fmt.Sprintf("%s-%s", spec.Name, spec.Version))
 }
 
+// IsInstalled reports whether spec is completely installed.
 func IsInstalled(conf *config.Config, spec inspector.PackageManagerSpec) bool {
 	installPath := GetInstallPath(conf, spec)
-	var path string
-	if spec.Name == "bun" {
-		path = filepath.Join(installPath, "bun")
-	} else {
-		path = filepath.Join(installPath, "package.json")
+	if _, err := os.Stat(filepath.Join(installPath, completeMarker)); err == nil {
+		return true
+	}
+	return adoptLegacyInstall(installPath, spec)
+}
+
+// isComplete is IsInstalled without adopting legacy installs, for callers
+// that only look at the store and must leave it as it is.
+func isComplete(installPath string, spec inspector.PackageManagerSpec) bool {
+	if _, err := os.Stat(filepath.Join(installPath, completeMarker)); err == nil {
+		return true
+	}
+	return isIntactInstall(installPath, spec)
+}
+
+// installedAndVerified reports whether spec is installed and matches the
+// hash in it. An install with nothing to check that hash against is
+// reported as missing, so that it is downloaded and verified again.
+func installedAndVerified(conf *config.Config, spec inspector.PackageManagerSpec) (bool, error) {
+	if !IsInstalled(conf, spec) {
+		return false, nil
 	}
-	_, err := os.Stat(path)
-	return err == nil
+	return verifyInstalled(conf, spec)
 }
 
 func Install(conf *config.Config, spec inspector.PackageManagerSpec) error {
-	if IsInstalled(conf, spec) {
-		return nil
+	if ok, err := installedAndVerified(conf, spec); ok || err != nil {
+		return err
+	}
+	if registry.IsOffline(conf) {
+		if IsInstalled(conf, spec) {
+			return fmt.Errorf("can't verify the installed %s@%s against its %s hash while offline", spec.Name, spec.Version, spec.HashAlgorithm)
+		}
+		return NewOfflineError(conf, spec)
+	}
+
+	unlock, err := lockInstall(conf, spec)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Another process may have finished installing while we waited.
+	if ok, err := installedAndVerified(conf, spec); ok || err != nil {
+		return err
 	}
 
 	fmt.Printf("Installing %s@%s...\n", spec.Name, spec.Version)
 
-	if spec.Name == "bun" {
-		return installBun(conf, spec)
+	// Everything is downloaded and extracted into a sibling staging
+	// directory, which is only renamed into place once it is complete.
+	installPath := GetInstallPath(conf, spec)
+	versionsDir := filepath.Dir(installPath)
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create install path: %w", err)
 	}
+	cleanStaleStaging(versionsDir)
 
-	body, err := registry.DownloadTarball(conf, spec)
+	staging, err := os.MkdirTemp(versionsDir, fmt.Sprintf("%s%s-%s-", stagingPrefix, spec.Name, spec.Version))
 	if err != nil {
-		return fmt.Errorf("failed to download: %w", err)
+		return fmt.Errorf("failed to create staging dir: %w", err)
 	}
-	defer body.Close()
+	defer os.RemoveAll(staging)
 
-	installPath := GetInstallPath(conf, spec)
-	if err := os.RemoveAll(installPath); err != nil {
-		return fmt.Errorf("failed to clean install path: %w", err)
+	archive, err := fetchArchive(conf, spec, staging)
+	if err != nil {
+		return err
 	}
-	if err := os.MkdirAll(installPath, 0755); err != nil {
-		return fmt.Errorf("failed to create install path: %w", err)
+	defer discardArchive(archive)
+
+	archiveSHA512, err := sha512File(archive)
+	if err != nil {
+		return fmt.Errorf("failed to hash archive: %w", err)
 	}
 
-	if err := extractTarGz(body, installPath); err != nil {
+	stagedPath := filepath.Join(staging, "package")
+	if err := os.Mkdir(stagedPath, 0755); err != nil {
+		return fmt.Errorf("failed to create staging dir: %w", err)
+	}
+
+	if spec.Name == "bun" {
+		err = extractBun(archive, stagedPath)
+	} else {
+		err = extractTarGz(archive, stagedPath)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to extract: %w", err)
 	}
+	if registry.IsBerry(spec) {
+		if err := verifyBerryBin(spec, stagedPath); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	if err := writeCompleteMarker(stagedPath, spec, archiveSHA512); err != nil {
+		return fmt.Errorf("failed to write install marker: %w", err)
+	}
+
+	// Anything already at installPath is the remains of an interrupted
+	// install, or one whose hash couldn't be checked.
+	if err := os.RemoveAll(installPath); err != nil {
+		return fmt.Errorf("failed to clean install path: %w", err)
+	}
+	if err := os.Rename(stagedPath, installPath); err != nil {
+		return fmt.Errorf("failed to move install into place: %w", err)
+	}
+
+	return syncDir(versionsDir)
 }
 
-func extractTarGz(gzipStream io.Reader, dest string) error {
-	uncompressedStream, err := gzip.NewReader(gzipStream)
+// fetchArchive downloads spec's archive into dir, verified against the hash
+// in spec and the registry's published digests. A Yarn Berry spec's hash is
+// of the extracted bundle, which Install checks instead.
+func fetchArchive(conf *config.Config, spec inspector.PackageManagerSpec, dir string) (*os.File, error) {
+	var checksums []*checksum
+	specCheck, err := specChecksum(spec)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if specCheck != nil && !registry.IsBerry(spec) {
+		checksums = append(checksums, specCheck)
 	}
 
-	tarReader := tar.NewReader(uncompressedStream)
-
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
+	// Bun is downloaded from GitHub releases, which has no dist metadata.
+	if spec.Name != "bun" {
+		dist, err := registry.GetDist(conf, spec)
+		if errors.Is(err, registry.ErrOffline) {
+			return nil, NewOfflineError(conf, spec)
 		}
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to get dist metadata: %w", err)
 		}
-
-		// Most npm packages contain a "package/" prefix in the tarball
-		// we want to strip the first component
-		parts := strings.Split(header.Name, "/")
-		if len(parts) <= 1 {
-			continue
+		distCheck, err := distChecksum(dist)
+		if err != nil {
+			return nil, err
 		}
-		relPath := filepath.Join(parts[1:]...)
-		target := filepath.Join(dest, relPath)
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0755); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return err
-			}
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(f, tarReader); err != nil {
-				f.Close()
-				return err
-			}
-			f.Close()
+		if distCheck != nil {
+			checksums = append(checksums, distCheck)
 		}
 	}
-	return nil
+
+	var body io.ReadCloser
+	if spec.Name == "bun" {
+		body, err = registry.DownloadBunZip(conf, spec, runtime.GOOS, runtime.GOARCH)
+	} else {
+		body, err = registry.DownloadTarball(conf, spec)
+	}
+	if errors.Is(err, registry.ErrOffline) {
+		return nil, NewOfflineError(conf, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download: %w", err)
+	}
+	defer body.Close()
+
+	archive, err := downloadArchive(body, dir, spec, checksums)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download: %w", err)
+	}
+	return archive, nil
 }
 
 func GetExecutablePath(conf *config.Config, spec inspector.PackageManagerSpec, executableName string) (string, error) {
@@ -149,29 +218,14 @@ func GetExecutablePath(conf *config.Config, spec inspector.PackageManagerSpec, e
 	return filepath.Join(installPath, relPath), nil
 }
 
-func installBun(conf *config.Config, spec inspector.PackageManagerSpec) error {
-	body, err := registry.DownloadBunZip(conf, spec, runtime.GOOS, runtime.GOARCH)
+func extractBun(archive *os.File, installPath string) error {
+	info, err := archive.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to download: %w", err)
+		return fmt.Errorf("failed to read archive: %w", err)
 	}
-	defer body.Close()
 
-	installPath := GetInstallPath(conf, spec)
-	if err := os.RemoveAll(installPath); err != nil {
-		return fmt.Errorf("failed to clean install path: %w", err)
-	}
-	if err := os.MkdirAll(installPath, 0755); err != nil {
-		return fmt.Errorf("failed to create install path: %w", err)
-	}
-
-	// Zip requires ReaderAt, so we must read all to memory
-	data, err := io.ReadAll(body)
-	if err != nil {
-		return fmt.Errorf("failed to read body: %w", err)
-	}
-
-	if err := extractZip(bytes.NewReader(data), int64(len(data)), installPath); err != nil {
-		return fmt.Errorf("failed to extract: %w", err)
+	if err := extractZip(archive, info.Size(), installPath); err != nil {
+		return err
 	}
 
 	// Make sure it is executable
@@ -182,50 +236,31 @@ func installBun(conf *config.Config, spec inspector.PackageManagerSpec) error {
 	return nil
 }
 
-func extractZip(idx *bytes.Reader, size int64, dest string) error {
-	r, err := zip.NewReader(idx, size)
-	if err != nil {
-		return err
-	}
-
-	for _, f := range r.File {
-		// Strip top level folder
-		parts := strings.Split(f.Name, "/")
-		if len(parts) <= 1 {
-			continue
-		}
-		relPath := filepath.Join(parts[1:]...)
-		target := filepath.Join(dest, relPath)
-
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(target, 0755)
-			continue
-		}
-
-		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-			return err
-		}
-
-		dstFile, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
-		}
+// DefaultConcurrency bounds how many versions InstallAll downloads at once.
+const DefaultConcurrency = 4
 
-		fileInArchive, err := f.Open()
-		if err != nil {
-			dstFile.Close()
-			return err
-		}
-
-		if _, err := io.Copy(dstFile, fileInArchive); err != nil {
-			fileInArchive.Close()
-			dstFile.Close()
-			return err
-		}
+// InstallAll installs specs with at most concurrency downloads in flight.
+// Every spec is attempted; the errors of those that failed are joined.
+func InstallAll(conf *config.Config, specs []inspector.PackageManagerSpec, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		fileInArchive.Close()
-		dstFile.Close()
+	errs := make([]error, len(specs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := Install(conf, spec); err != nil {
+				errs[i] = fmt.Errorf("%s@%s: %w", spec.Name, spec.Version, err)
+			}
+		}()
 	}
+	wg.Wait()
 
-	return nil
+	return errors.Join(errs...)
 }
@@ -1,20 +1,466 @@
-package installer
+package installer_test
 
 import (
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ehyland/pmm2/internal/config"
 	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+	"github.com/ehyland/pmm2/internal/registry"
 )
 
 func TestGetInstallPath(t *testing.T) {
 	conf := &config.Config{PmmDir: "/tmp/.pmm"}
 	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "8.0.0"}
-	path := GetInstallPath(conf, spec)
+	path := installer.GetInstallPath(conf, spec)
 	expected := filepath.Join("/tmp/.pmm", "installed-versions", "pnpm-8.0.0")
 	if path != expected {
 		t.Errorf("expected %s, got %s", expected, path)
 
 	}
 }
+
+// newTarballServer publishes tarball as pnpm 9.0.0.
+func newTarballServer(t *testing.T, tarball []byte) *httptest.Server {
+	return installertest.NewRegistry(t, map[string]installertest.Package{
+		"pnpm": {Versions: []string{"9.0.0"}, Tarball: tarball},
+	})
+}
+
+// newBerryServer publishes tarball as Yarn Berry 4.5.0.
+func newBerryServer(t *testing.T, tarball []byte) *httptest.Server {
+	return installertest.NewRegistry(t, map[string]installertest.Package{
+		registry.BerryPackage: {Versions: []string{"4.5.0"}, Tarball: tarball},
+	})
+}
+
+func TestInstall_VerifiesSpecHash(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	server := newTarballServer(t, tarball)
+	sum := sha512.Sum512(tarball)
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0", HashAlgorithm: "sha512", Hash: hex.EncodeToString(sum[:])}
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	exePath, err := installer.GetExecutablePath(conf, spec, "pnpm")
+	if err != nil {
+		t.Fatalf("GetExecutablePath() error = %v", err)
+	}
+	if _, err := os.Stat(exePath); err != nil {
+		t.Errorf("expected %s to be installed: %v", exePath, err)
+	}
+}
+
+func TestCorepackSHA512(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	server := newTarballServer(t, tarball)
+	sum := sha512.Sum512(tarball)
+	want := hex.EncodeToString(sum[:])
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	marker, err := installer.ReadCompleteMarker(installer.GetInstallPath(conf, spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker.SHA512 != want {
+		t.Errorf("expected install marker to record sha512 %s, got %s", want, marker.SHA512)
+	}
+
+	got, err := installer.CorepackSHA512(conf, spec)
+	if err != nil || got != want {
+		t.Errorf("CorepackSHA512() = %s, %v, want %s", got, err, want)
+	}
+
+	// Installs from before the digest was recorded are downloaded again.
+	if err := installer.WriteCompleteMarker(installer.GetInstallPath(conf, spec), spec, ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err = installer.CorepackSHA512(conf, spec)
+	if err != nil || got != want {
+		t.Errorf("CorepackSHA512() without recorded digest = %s, %v, want %s", got, err, want)
+	}
+}
+
+func TestInstall_BerryCorepackHash(t *testing.T) {
+	server := newBerryServer(t, installertest.Tarball(t, installertest.BerryFiles))
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec, err := inspector.ParseSpecString("yarn@4.5.0+sha512." + installertest.BerryHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	conf.PmmDir = t.TempDir()
+	spec.Hash = strings.Repeat("0", len(installertest.BerryHash))
+	err = installer.Install(conf, spec)
+	var integrityErr *installer.IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("expected IntegrityError, got %v", err)
+	}
+	if integrityErr.File != "bin/yarn.js" || integrityErr.Actual != installertest.BerryHash {
+		t.Errorf("unexpected IntegrityError %+v", integrityErr)
+	}
+	if installer.IsInstalled(conf, spec) {
+		t.Error("expected mismatched bundle not to be installed")
+	}
+}
+
+func TestCorepackSHA512_Berry(t *testing.T) {
+	server := newBerryServer(t, installertest.Tarball(t, installertest.BerryFiles))
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "yarn", Version: "4.5.0"}
+	got, err := installer.CorepackSHA512(conf, spec)
+	if err != nil || got != installertest.BerryHash {
+		t.Fatalf("CorepackSHA512() = %s, %v, want %s", got, err, installertest.BerryHash)
+	}
+
+	// What pin writes is what a fresh install verifies.
+	conf.PmmDir = t.TempDir()
+	spec.HashAlgorithm, spec.Hash = "sha512", got
+	if err := installer.Install(conf, spec); err != nil {
+		t.Errorf("Install() with the pinned hash error = %v", err)
+	}
+}
+
+func TestInstall_VerifiesInstalledHash(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	server := newTarballServer(t, tarball)
+	sum := sha512.Sum512(tarball)
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	spec.HashAlgorithm, spec.Hash = "sha512", hex.EncodeToString(sum[:])
+	if err := installer.Install(conf, spec); err != nil {
+		t.Errorf("Install() of installed version with its hash error = %v", err)
+	}
+
+	spec.Hash = hex.EncodeToString(make([]byte, sha512.Size))
+	var integrityErr *installer.IntegrityError
+	if err := installer.Install(conf, spec); !errors.As(err, &integrityErr) || integrityErr.File != "installed archive" {
+		t.Errorf("expected IntegrityError for the installed archive, got %v", err)
+	}
+
+	// Without a recorded digest the install is downloaded and checked again.
+	spec.Hash = hex.EncodeToString(sum[:])
+	if err := installer.WriteCompleteMarker(installer.GetInstallPath(conf, spec), inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() without recorded digest error = %v", err)
+	}
+	marker, err := installer.ReadCompleteMarker(installer.GetInstallPath(conf, spec))
+	if err != nil || marker.SHA512 != spec.Hash {
+		t.Errorf("expected the reinstall to record its digest, got %+v, %v", marker, err)
+	}
+}
+
+func TestInstall_VerifiesInstalledBerryBin(t *testing.T) {
+	server := newBerryServer(t, installertest.Tarball(t, installertest.BerryFiles))
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "yarn", Version: "4.5.0"}
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	bin := filepath.Join(installer.GetInstallPath(conf, spec), "bin", "yarn.js")
+	if err := os.WriteFile(bin, []byte("console.log('tampered')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec.HashAlgorithm, spec.Hash = "sha512", installertest.BerryHash
+	var integrityErr *installer.IntegrityError
+	if err := installer.Install(conf, spec); !errors.As(err, &integrityErr) || integrityErr.File != "bin/yarn.js" {
+		t.Errorf("expected IntegrityError for a tampered bin/yarn.js, got %v", err)
+	}
+}
+
+func TestInstall_SpecHashMismatch(t *testing.T) {
+	server := newTarballServer(t, installertest.Tarball(t, installertest.PnpmFiles))
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0", HashAlgorithm: "sha512", Hash: hex.EncodeToString(make([]byte, sha512.Size))}
+	err := installer.Install(conf, spec)
+
+	var integrityErr *installer.IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("expected IntegrityError, got %v", err)
+	}
+	if integrityErr.Source != "packageManager" || integrityErr.Algorithm != "sha512" {
+		t.Errorf("unexpected IntegrityError %+v", integrityErr)
+	}
+	if installer.IsInstalled(conf, spec) {
+		t.Error("expected mismatched archive not to be installed")
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(conf.PmmDir, "installed-versions"))
+	if len(entries) != 0 {
+		t.Errorf("expected no leftover files, got %v", entries)
+	}
+}
+
+func TestInstall_DistIntegrityMismatch(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	sum := sha512.Sum512([]byte("something else"))
+	server := installertest.NewRegistry(t, map[string]installertest.Package{
+		"pnpm": {Versions: []string{"9.0.0"}, Tarball: tarball, Dist: &registry.Dist{Integrity: "sha1-AAAA sha512-" + base64.StdEncoding.EncodeToString(sum[:])}},
+	})
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	err := installer.Install(conf, spec)
+
+	var integrityErr *installer.IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("expected IntegrityError, got %v", err)
+	}
+	if integrityErr.Source != "dist.integrity" || integrityErr.Algorithm != "sha512" {
+		t.Errorf("expected the sha512 dist.integrity to be checked, got %+v", integrityErr)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(conf.PmmDir, "installed-versions"))
+	if len(entries) != 0 {
+		t.Errorf("expected no leftover files, got %v", entries)
+	}
+}
+
+func TestInstall_DistShasum(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	sum := sha1.Sum(tarball)
+	server := installertest.NewRegistry(t, map[string]installertest.Package{
+		"pnpm": {Versions: []string{"9.0.0"}, Tarball: tarball, Dist: &registry.Dist{Shasum: hex.EncodeToString(sum[:])}},
+	})
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if !installer.IsInstalled(conf, spec) {
+		t.Error("expected pnpm@9.0.0 to be installed")
+	}
+}
+
+func TestInstall_ReplacesInterruptedInstall(t *testing.T) {
+	server := newTarballServer(t, installertest.Tarball(t, installertest.PnpmFiles))
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+
+	// A half-extracted install: package.json is there but the marker isn't.
+	installPath := installer.GetInstallPath(conf, spec)
+	if err := os.MkdirAll(installPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(installPath, "package.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if installer.IsInstalled(conf, spec) {
+		t.Fatal("expected install without marker not to count as installed")
+	}
+
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if !installer.IsInstalled(conf, spec) {
+		t.Fatal("expected pnpm@9.0.0 to be installed")
+	}
+	if _, err := installer.GetExecutablePath(conf, spec, "pnpm"); err != nil {
+		t.Errorf("GetExecutablePath() error = %v", err)
+	}
+}
+
+func TestIsInstalled_AdoptsLegacyInstall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "8.15.9"}
+
+	// Installed by a pmm2 that predates the completion marker.
+	installPath := installer.GetInstallPath(conf, spec)
+	for name, content := range installertest.PnpmFiles {
+		path := filepath.Join(installPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := installer.Install(conf, spec); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if _, err := installer.ReadCompleteMarker(installPath); err != nil {
+		t.Errorf("expected legacy install to be marked complete: %v", err)
+	}
+
+	// One whose entry point never made it is not adopted.
+	partial := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	partialPath := installer.GetInstallPath(conf, partial)
+	if err := os.MkdirAll(partialPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(partialPath, "package.json"), []byte(installertest.PnpmFiles["package.json"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if installer.IsInstalled(conf, partial) {
+		t.Error("expected install without its bin to count as missing")
+	}
+}
+
+func TestInstall_CleansStaleStaging(t *testing.T) {
+	server := newTarballServer(t, installertest.Tarball(t, installertest.PnpmFiles))
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	versionsDir := filepath.Join(conf.PmmDir, "installed-versions")
+
+	stale := filepath.Join(versionsDir, installer.StagingPrefix+"pnpm-8.0.0-123")
+	fresh := filepath.Join(versionsDir, installer.StagingPrefix+"pnpm-8.1.0-456")
+	for _, dir := range []string{stale, fresh} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * installer.StaleStagingAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := installer.Install(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale staging dir to be removed, got %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("expected in-progress staging dir to be kept, got %v", err)
+	}
+}
+
+func TestInstallAll(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	sum := sha512.Sum512(tarball)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	versions := []string{"9.0.0", "9.1.0", "9.2.0", "9.3.0", "9.4.0"}
+
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pnpm" {
+			packument := registry.Packument{Versions: map[string]registry.PackumentVersion{}}
+			for _, v := range versions {
+				packument.Versions[v] = registry.PackumentVersion{Dist: registry.Dist{Integrity: integrity}}
+			}
+			json.NewEncoder(w).Encode(packument)
+			return
+		}
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write(tarball)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	var specs []inspector.PackageManagerSpec
+	for _, v := range versions {
+		specs = append(specs, inspector.PackageManagerSpec{Name: "pnpm", Version: v})
+	}
+	specs = append(specs, inspector.PackageManagerSpec{Name: "pnpm", Version: "8.0.0"})
+
+	err := installer.InstallAll(conf, specs, 2)
+	if err == nil || !strings.Contains(err.Error(), "pnpm@8.0.0") {
+		t.Fatalf("expected error for unpublished pnpm@8.0.0, got %v", err)
+	}
+	for _, spec := range specs[:len(versions)] {
+		if !installer.IsInstalled(conf, spec) {
+			t.Errorf("expected %s to be installed", spec)
+		}
+	}
+	if got := maxInFlight.Load(); got > 2 {
+		t.Errorf("expected at most 2 parallel downloads, got %d", got)
+	}
+}
+
+func TestInstall_Concurrent(t *testing.T) {
+	tarball := installertest.Tarball(t, installertest.PnpmFiles)
+	sum := sha512.Sum512(tarball)
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pnpm" {
+			json.NewEncoder(w).Encode(registry.Packument{
+				Versions: map[string]registry.PackumentVersion{
+					"9.0.0": {Dist: registry.Dist{Integrity: "sha512-" + base64.StdEncoding.EncodeToString(sum[:])}},
+				},
+			})
+			return
+		}
+		downloads.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write(tarball)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = installer.Install(conf, spec)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Install() error = %v", err)
+		}
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("expected a single download, got %d", n)
+	}
+	if !installer.IsInstalled(conf, spec) {
+		t.Error("expected pnpm@9.0.0 to be installed")
+	}
+}
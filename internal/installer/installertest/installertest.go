@@ -0,0 +1,141 @@
+// Package installertest lays out installed package manager versions, and
+// the registry they are installed from, for tests.
+package installertest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+// FakeInstall creates a complete, empty install of name@version without
+// downloading anything.
+func FakeInstall(tb testing.TB, conf *config.Config, name, version string) {
+	tb.Helper()
+	if err := installer.MarkInstalled(conf, inspector.PackageManagerSpec{Name: name, Version: version}); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// PnpmFiles is a stand-in for the pnpm package.
+var PnpmFiles = map[string]string{
+	"package.json": `{"name": "pnpm", "bin": {"pnpm": "bin/pnpm.cjs"}}`,
+	"bin/pnpm.cjs": "console.log('pnpm')",
+}
+
+// BerryFiles is a stand-in for @yarnpkg/cli-dist. BerryHash is what
+// corepack 0.33 recorded for it: `corepack install -g yarn@4.5.0` with
+// COREPACK_NPM_REGISTRY pointed at this tarball.
+var BerryFiles = map[string]string{
+	"package.json": `{"name": "@yarnpkg/cli-dist", "version": "4.5.0", "bin": {"yarn": "bin/yarn.js", "yarnpkg": "bin/yarn.js"}}`,
+	"bin/yarn.js":  "#!/usr/bin/env node\nconsole.log(\"4.5.0\");\n",
+}
+
+const BerryHash = "b00dea812a80b4022f4b5e680cf88cb33df316f24e4b74f921607eb32080bc95f81a024686367022e7e1fe51271d0faefd2a70e80794c7370a3b68fe9d262110"
+
+// TarEntry is a file, directory or link in an archive built by TarGz. Mode
+// defaults to 0644.
+type TarEntry struct {
+	Name     string
+	Typeflag byte
+	Linkname string
+	Mode     int64
+	Content  string
+}
+
+// TarGz packs entries as they are, in order.
+func TarGz(tb testing.TB, entries []TarEntry) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		mode := e.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr := &tar.Header{Name: e.Name, Typeflag: e.Typeflag, Linkname: e.Linkname, Mode: mode, Size: int64(len(e.Content))}
+		if e.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			tb.Fatal(err)
+		}
+		if e.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.Content)); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Tarball packs files the way npm does, under a "package/" prefix.
+func Tarball(tb testing.TB, files map[string]string) []byte {
+	tb.Helper()
+	var entries []TarEntry
+	for name, content := range files {
+		entries = append(entries, TarEntry{Name: "package/" + name, Typeflag: tar.TypeReg, Content: content})
+	}
+	return TarGz(tb, entries)
+}
+
+// Package is a package served by NewRegistry, with every version published
+// as Tarball. Dist replaces the digests listed for each version, which are
+// otherwise the sha512 integrity of Tarball.
+type Package struct {
+	DistTags map[string]string
+	Versions []string
+	Tarball  []byte
+	Dist     *registry.Dist
+}
+
+// NewRegistry serves packuments and tarballs for packages, keyed by name.
+func NewRegistry(tb testing.TB, packages map[string]Package) *httptest.Server {
+	tb.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _, isTarball := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/-/")
+		pkg, ok := packages[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if isTarball {
+			w.Write(pkg.Tarball)
+			return
+		}
+
+		dist := registry.Dist{}
+		if pkg.Dist != nil {
+			dist = *pkg.Dist
+		} else {
+			sum := sha512.Sum512(pkg.Tarball)
+			dist.Integrity = "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+		}
+		packument := registry.Packument{DistTags: pkg.DistTags, Versions: map[string]registry.PackumentVersion{}}
+		for _, version := range pkg.Versions {
+			packument.Versions[version] = registry.PackumentVersion{Dist: dist}
+		}
+		json.NewEncoder(w).Encode(packument)
+	}))
+	tb.Cleanup(server.Close)
+	return server
+}
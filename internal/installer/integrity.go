@@ -0,0 +1,307 @@
+package installer
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+// IntegrityError is returned when a downloaded archive doesn't match an
+// expected digest. The archive is discarded before anything is extracted.
+type IntegrityError struct {
+	Spec      inspector.PackageManagerSpec
+	Source    string
+	Algorithm string
+	Expected  string
+	Actual    string
+	// File is the file that was hashed, if not the whole archive.
+	File string
+}
+
+func (e *IntegrityError) Error() string {
+	hashed := "downloaded archive"
+	if e.File != "" {
+		hashed = e.File
+	}
+	return fmt.Sprintf("integrity check failed for %s@%s: %s expects %s %s, %s has %s", e.Spec.Name, e.Spec.Version, e.Source, e.Algorithm, e.Expected, hashed, e.Actual)
+}
+
+// berryBin is the file corepack hashes for Yarn 2+. Corepack installs Berry
+// as this single bundle, whether from repo.yarnpkg.com or the cli-dist
+// tarball, so the "+sha512" of a yarn@>=2 spec is its digest and not the
+// tarball's.
+const berryBin = "bin/yarn.js"
+
+type checksum struct {
+	source    string
+	algorithm string
+	expected  []byte
+	encode    func([]byte) string
+	hash      hash.Hash
+	file      string
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha224":
+		return sha256.New224(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha384":
+		return sha512.New384(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+}
+
+// specChecksum returns the check for the hash in a "+sha512.<hex>" spec, or
+// nil if the spec doesn't carry one.
+func specChecksum(spec inspector.PackageManagerSpec) (*checksum, error) {
+	if spec.Hash == "" {
+		return nil, nil
+	}
+	h, err := newHash(spec.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := hex.DecodeString(spec.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s hash in spec: %w", spec.HashAlgorithm, err)
+	}
+	return &checksum{
+		source:    "packageManager",
+		algorithm: spec.HashAlgorithm,
+		expected:  expected,
+		encode:    hex.EncodeToString,
+		hash:      h,
+	}, nil
+}
+
+// integrityStrength orders the SRI algorithms so that the strongest one in
+// dist.integrity is the one checked.
+var integrityStrength = map[string]int{"sha1": 1, "sha256": 2, "sha384": 3, "sha512": 4}
+
+// distChecksum returns the check for the registry's dist.integrity, falling
+// back to dist.shasum for packages published before integrity existed.
+func distChecksum(dist *registry.Dist) (*checksum, error) {
+	var algorithm, digest string
+	for _, entry := range strings.Fields(dist.Integrity) {
+		algo, value, ok := strings.Cut(entry, "-")
+		if !ok || integrityStrength[algo] <= integrityStrength[algorithm] {
+			continue
+		}
+		algorithm, digest = algo, value
+	}
+
+	if algorithm != "" {
+		expected, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dist.integrity %q: %w", dist.Integrity, err)
+		}
+		h, _ := newHash(algorithm)
+		return &checksum{
+			source:    "dist.integrity",
+			algorithm: algorithm,
+			expected:  expected,
+			encode:    func(b []byte) string { return base64.StdEncoding.EncodeToString(b) },
+			hash:      h,
+		}, nil
+	}
+
+	if dist.Shasum != "" {
+		expected, err := hex.DecodeString(dist.Shasum)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dist.shasum %q: %w", dist.Shasum, err)
+		}
+		return &checksum{
+			source:    "dist.shasum",
+			algorithm: "sha1",
+			expected:  expected,
+			encode:    hex.EncodeToString,
+			hash:      sha1.New(),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func (c *checksum) verify(spec inspector.PackageManagerSpec) error {
+	actual := c.hash.Sum(nil)
+	if bytes.Equal(actual, c.expected) {
+		return nil
+	}
+	return &IntegrityError{
+		Spec:      spec,
+		Source:    c.source,
+		Algorithm: c.algorithm,
+		Expected:  c.encode(c.expected),
+		Actual:    c.encode(actual),
+		File:      c.file,
+	}
+}
+
+// verifyBerryBin checks the hash in a Yarn Berry spec against the bundle
+// extracted into dir.
+func verifyBerryBin(spec inspector.PackageManagerSpec, dir string) error {
+	c, err := specChecksum(spec)
+	if err != nil || c == nil {
+		return err
+	}
+	c.file = berryBin
+	if err := hashFile(c.hash, filepath.Join(dir, berryBin)); err != nil {
+		return err
+	}
+	return c.verify(spec)
+}
+
+// verifyInstalled checks the hash in spec against its install: against
+// bin/yarn.js for Yarn Berry, and otherwise against the archive digest the
+// install recorded. It reports false when there is nothing to check against,
+// such as an install that predates recorded digests.
+func verifyInstalled(conf *config.Config, spec inspector.PackageManagerSpec) (bool, error) {
+	if spec.Hash == "" {
+		return true, nil
+	}
+	installPath := GetInstallPath(conf, spec)
+	if registry.IsBerry(spec) {
+		return true, verifyBerryBin(spec, installPath)
+	}
+
+	marker, err := readCompleteMarker(installPath)
+	if err != nil {
+		return false, nil
+	}
+	// Installed from this very spec, so the download was checked against
+	// this hash.
+	if marker.Spec == spec.String() {
+		return true, nil
+	}
+	if spec.HashAlgorithm != "sha512" || marker.SHA512 == "" {
+		return false, nil
+	}
+	if !strings.EqualFold(marker.SHA512, spec.Hash) {
+		return true, &IntegrityError{
+			Spec:      spec,
+			Source:    "packageManager",
+			Algorithm: spec.HashAlgorithm,
+			Expected:  spec.Hash,
+			Actual:    marker.SHA512,
+			File:      "installed archive",
+		}
+	}
+	return true, nil
+}
+
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// downloadArchive copies body into a temporary file in dir, hashing it on the
+// way, and only returns the file once every checksum has matched.
+func downloadArchive(body io.Reader, dir string, spec inspector.PackageManagerSpec, checksums []*checksum) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, ".download-")
+	if err != nil {
+		return nil, err
+	}
+
+	writers := []io.Writer{f}
+	for _, c := range checksums {
+		writers = append(writers, c.hash)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), body); err != nil {
+		discardArchive(f)
+		return nil, err
+	}
+
+	for _, c := range checksums {
+		if err := c.verify(spec); err != nil {
+			discardArchive(f)
+			return nil, err
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		discardArchive(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+// sha512File hashes the archive f and rewinds it.
+func sha512File(f *os.File) (string, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CorepackSHA512 returns the hex sha512 that corepack checks in a
+// "+sha512" spec: that of bin/yarn.js for Yarn Berry, which it installs, and
+// of the archive for everything else. The archive's is recorded at install
+// time; installs that predate that are downloaded again to hash.
+func CorepackSHA512(conf *config.Config, spec inspector.PackageManagerSpec) (string, error) {
+	if registry.IsBerry(spec) {
+		if err := Install(conf, spec); err != nil {
+			return "", err
+		}
+		h := sha512.New()
+		if err := hashFile(h, filepath.Join(GetInstallPath(conf, spec), berryBin)); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	if marker, err := readCompleteMarker(GetInstallPath(conf, spec)); err == nil && marker.SHA512 != "" {
+		return marker.SHA512, nil
+	}
+
+	dir, err := os.MkdirTemp("", "pmm-hash-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := fetchArchive(conf, spec, dir)
+	if err != nil {
+		return "", err
+	}
+	defer discardArchive(archive)
+	return sha512File(archive)
+}
+
+func discardArchive(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,102 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+const lockPollInterval = 100 * time.Millisecond
+
+// LockTimeoutError is returned when another process held the install lock
+// for longer than the configured timeout.
+type LockTimeoutError struct {
+	Spec    inspector.PackageManagerSpec
+	Path    string
+	Holder  int
+	Timeout time.Duration
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for pid %d to finish installing %s@%s (lock: %s)", e.Timeout, e.Holder, e.Spec.Name, e.Spec.Version, e.Path)
+}
+
+func getLockPath(conf *config.Config, spec inspector.PackageManagerSpec) string {
+	return filepath.Join(conf.PmmDir, "locks", fmt.Sprintf("%s-%s.lock", spec.Name, spec.Version))
+}
+
+// lockInstall takes an exclusive advisory lock on spec, so that concurrent
+// shims don't install the same version over each other. The kernel drops
+// the lock when its holder exits, so a lock that is held always belongs to a
+// live process. The holder's pid is recorded only to report who we waited
+// for: it may be from another pid namespace, or not written yet.
+func lockInstall(conf *config.Config, spec inspector.PackageManagerSpec) (func(), error) {
+	lockPath := getLockPath(conf, spec)
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock dir: %w", err)
+	}
+
+	timeout := conf.LockTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultLockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock: %w", err)
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", lockPath, err)
+		}
+		if time.Now().After(deadline) {
+			holder := readLockOwner(f)
+			f.Close()
+			return nil, &LockTimeoutError{Spec: spec, Path: lockPath, Holder: holder, Timeout: timeout}
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	if err := writeLockOwner(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write lock: %w", err)
+	}
+	return func() {
+		f.Truncate(0)
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func writeLockOwner(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return err
+}
+
+func readLockOwner(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
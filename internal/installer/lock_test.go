@@ -0,0 +1,98 @@
+package installer
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+func TestLockInstall_Timeout(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir(), LockTimeout: 200 * time.Millisecond}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+
+	unlock, err := lockInstall(conf, spec)
+	if err != nil {
+		t.Fatalf("lockInstall() error = %v", err)
+	}
+	defer unlock()
+
+	_, err = lockInstall(conf, spec)
+	var timeoutErr *LockTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected LockTimeoutError, got %v", err)
+	}
+	if timeoutErr.Holder != os.Getpid() {
+		t.Errorf("expected holder %d, got %d", os.Getpid(), timeoutErr.Holder)
+	}
+}
+
+// TestLockInstall_HelperProcess takes the lock in a child process and exits
+// without releasing it.
+func TestLockInstall_HelperProcess(t *testing.T) {
+	pmmDir := os.Getenv("PMM_TEST_LOCK_DIR")
+	if pmmDir == "" {
+		t.Skip("only run as a helper process")
+	}
+	conf := &config.Config{PmmDir: pmmDir}
+	if _, err := lockInstall(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Exit(0)
+}
+
+func TestLockInstall_DeadHolder(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir(), LockTimeout: time.Second}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockInstall_HelperProcess$")
+	cmd.Env = append(os.Environ(), "PMM_TEST_LOCK_DIR="+conf.PmmDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("helper process failed: %v\n%s", err, out)
+	}
+	data, _ := os.ReadFile(getLockPath(conf, spec))
+	if string(data) != strconv.Itoa(cmd.Process.Pid) {
+		t.Fatalf("expected the helper to have recorded pid %d, got %q", cmd.Process.Pid, data)
+	}
+
+	unlock, err := lockInstall(conf, spec)
+	if err != nil {
+		t.Fatalf("expected a lock left by an exited process to be free, got %v", err)
+	}
+	unlock()
+}
+
+func TestLockInstall_HeldLockNotTakenOver(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir(), LockTimeout: 300 * time.Millisecond}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("unable to run true: %v", err)
+	}
+
+	unlock, err := lockInstall(conf, spec)
+	if err != nil {
+		t.Fatalf("lockInstall() error = %v", err)
+	}
+	defer unlock()
+	// The pid of a holder in another pid namespace, or a stale one the new
+	// holder hasn't overwritten yet, can look dead from here.
+	if err := os.WriteFile(getLockPath(conf, spec), []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = lockInstall(conf, spec)
+	var timeoutErr *LockTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected a held lock to time out, got %v", err)
+	}
+	if _, err := os.Stat(getLockPath(conf, spec)); err != nil {
+		t.Errorf("expected the held lock file to stay in place: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+// OfflineError reports that Spec can't be satisfied without the network,
+// listing what is installed instead.
+type OfflineError struct {
+	Spec      inspector.PackageManagerSpec
+	Available []string
+}
+
+func (e *OfflineError) Error() string {
+	want := e.Spec.Name
+	if e.Spec.Version != "" {
+		want += "@" + e.Spec.Version
+	}
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("%s is not available offline; no %s versions are installed", want, e.Spec.Name)
+	}
+	return fmt.Sprintf("%s is not available offline; installed %s versions: %s", want, e.Spec.Name, strings.Join(e.Available, ", "))
+}
+
+// NewOfflineError builds an OfflineError listing the installed versions of
+// spec.Name.
+func NewOfflineError(conf *config.Config, spec inspector.PackageManagerSpec) *OfflineError {
+	available, _ := ListInstalled(conf, spec.Name)
+	return &OfflineError{Spec: spec, Available: available}
+}
+
+// ListInstalled returns the fully installed versions of name, oldest first.
+// It only reads the store.
+func ListInstalled(conf *config.Config, name string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(conf.PmmDir, "installed-versions"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*semver.Version
+	for _, entry := range entries {
+		v, ok := strings.CutPrefix(entry.Name(), name+"-")
+		if !entry.IsDir() || !ok {
+			continue
+		}
+		version, err := semver.StrictNewVersion(v)
+		spec := inspector.PackageManagerSpec{Name: name, Version: v}
+		if err != nil || !isComplete(GetInstallPath(conf, spec), spec) {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Sort(semver.Collection(versions))
+
+	installed := make([]string, len(versions))
+	for i, version := range versions {
+		installed[i] = version.Original()
+	}
+	return installed, nil
+}
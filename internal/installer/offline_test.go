@@ -0,0 +1,58 @@
+package installer_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+)
+
+func TestListInstalled(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	installertest.FakeInstall(t, conf, "pnpm", "9.0.0")
+	installertest.FakeInstall(t, conf, "pnpm", "10.1.0")
+	installertest.FakeInstall(t, conf, "pnpm", "8.15.9")
+	installertest.FakeInstall(t, conf, "npm", "10.0.0")
+
+	// Interrupted installs have no marker and don't count.
+	if err := os.MkdirAll(installer.GetInstallPath(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.1.0"}), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	installed, err := installer.ListInstalled(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("ListInstalled() error = %v", err)
+	}
+	if want := []string{"8.15.9", "9.0.0", "10.1.0"}; !reflect.DeepEqual(installed, want) {
+		t.Errorf("ListInstalled() = %v, want %v", installed, want)
+	}
+
+	empty, err := installer.ListInstalled(&config.Config{PmmDir: t.TempDir()}, "pnpm")
+	if err != nil || len(empty) != 0 {
+		t.Errorf("ListInstalled() on empty dir = %v, %v", empty, err)
+	}
+}
+
+func TestInstall_Offline(t *testing.T) {
+	conf := &config.Config{Registry: "http://127.0.0.1:0", PmmDir: t.TempDir(), Offline: true}
+	installertest.FakeInstall(t, conf, "pnpm", "9.0.0")
+
+	if err := installer.Install(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}); err != nil {
+		t.Fatalf("Install() of installed version error = %v", err)
+	}
+
+	err := installer.Install(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.1.0"})
+	var offlineErr *installer.OfflineError
+	if !errors.As(err, &offlineErr) {
+		t.Fatalf("expected OfflineError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "pnpm@9.1.0") || !strings.Contains(err.Error(), "9.0.0") {
+		t.Errorf("expected error to name the spec and installed versions, got %q", err)
+	}
+}
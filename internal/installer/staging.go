@@ -0,0 +1,142 @@
+package installer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+// completeMarker is written last into a staged install. An install directory
+// without it is treated as missing and replaced on the next Install, unless
+// it is an intact install from before markers existed.
+const completeMarker = ".pmm-complete"
+
+const stagingPrefix = ".staging-"
+
+// Staging directories older than this are assumed to belong to an install
+// that was interrupted, rather than one still in progress.
+const staleStagingAge = time.Hour
+
+type installMarker struct {
+	Spec        string    `json:"spec"`
+	InstalledAt time.Time `json:"installedAt"`
+	// SHA512 is the hex digest of the downloaded archive, as written into
+	// a "+sha512.<hex>" packageManager spec.
+	SHA512 string `json:"sha512,omitempty"`
+}
+
+func writeCompleteMarker(dir string, spec inspector.PackageManagerSpec, archiveSHA512 string) error {
+	data, err := json.Marshal(installMarker{Spec: spec.String(), InstalledAt: time.Now().UTC(), SHA512: archiveSHA512})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, completeMarker), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// MarkInstalled records whatever is at GetInstallPath(conf, spec) as a
+// complete install of spec, creating the directory if needed. Install does
+// this itself; it is for installs laid out by other means, such as test
+// fixtures.
+func MarkInstalled(conf *config.Config, spec inspector.PackageManagerSpec) error {
+	installPath := GetInstallPath(conf, spec)
+	if err := os.MkdirAll(installPath, 0755); err != nil {
+		return err
+	}
+	return writeCompleteMarker(installPath, spec, "")
+}
+
+// adoptLegacyInstall marks an install made before completion markers
+// existed, so that upgrading pmm2 doesn't download every installed version
+// again, or lose them all while offline. Only installs whose entry points
+// are all in place are adopted.
+func adoptLegacyInstall(installPath string, spec inspector.PackageManagerSpec) bool {
+	if !isIntactInstall(installPath, spec) {
+		return false
+	}
+	// A read-only store is still usable, it just stays unmarked.
+	writeCompleteMarker(installPath, spec, "")
+	return true
+}
+
+func isIntactInstall(installPath string, spec inspector.PackageManagerSpec) bool {
+	if spec.Name == "bun" {
+		info, err := os.Stat(filepath.Join(installPath, "bun"))
+		return err == nil && info.Mode().IsRegular()
+	}
+
+	data, err := os.ReadFile(filepath.Join(installPath, "package.json"))
+	if err != nil {
+		return false
+	}
+	var pkg PackageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil || len(pkg.Bin) == 0 {
+		return false
+	}
+	for _, relPath := range pkg.Bin {
+		if _, err := os.Stat(filepath.Join(installPath, relPath)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func readCompleteMarker(dir string) (*installMarker, error) {
+	data, err := os.ReadFile(filepath.Join(dir, completeMarker))
+	if err != nil {
+		return nil, err
+	}
+	var marker installMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return nil, err
+	}
+	return &marker, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// cleanStaleStaging removes staging directories left behind by installs that
+// were killed before they could clean up after themselves.
+func cleanStaleStaging(versionsDir string) {
+	entries, err := os.ReadDir(versionsDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleStagingAge {
+			continue
+		}
+		os.RemoveAll(filepath.Join(versionsDir, entry.Name()))
+	}
+}
@@ -0,0 +1,50 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+// ErrNotInstalled is returned when uninstalling a version that isn't in the
+// store.
+var ErrNotInstalled = errors.New("not installed")
+
+// Uninstall removes spec from the store. The complete marker goes first, so
+// a removal that is interrupted leaves an install that is treated as
+// missing rather than a broken one that is run.
+func Uninstall(conf *config.Config, spec inspector.PackageManagerSpec) error {
+	unlock, err := lockInstall(conf, spec)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if !IsInstalled(conf, spec) {
+		return fmt.Errorf("%s@%s: %w", spec.Name, spec.Version, ErrNotInstalled)
+	}
+
+	installPath := GetInstallPath(conf, spec)
+	if err := os.Remove(filepath.Join(installPath, completeMarker)); err != nil {
+		return fmt.Errorf("failed to remove install marker: %w", err)
+	}
+
+	// Moving the directory aside first means a partial removal is later
+	// swept up with stale staging directories.
+	trash, err := os.MkdirTemp(filepath.Dir(installPath), fmt.Sprintf("%s%s-%s-", stagingPrefix, spec.Name, spec.Version))
+	if err != nil {
+		return fmt.Errorf("failed to create staging dir: %w", err)
+	}
+	if err := os.Rename(installPath, filepath.Join(trash, "package")); err != nil {
+		os.Remove(trash)
+		return fmt.Errorf("failed to move install aside: %w", err)
+	}
+	if err := os.RemoveAll(trash); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", installPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package installer_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+)
+
+func TestUninstall(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	installertest.FakeInstall(t, conf, spec.Name, spec.Version)
+	installertest.FakeInstall(t, conf, "pnpm", "9.1.0")
+
+	if err := installer.Uninstall(conf, spec); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if _, err := os.Stat(installer.GetInstallPath(conf, spec)); !os.IsNotExist(err) {
+		t.Errorf("expected install dir to be removed, got %v", err)
+	}
+	if !installer.IsInstalled(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.1.0"}) {
+		t.Error("expected other versions to be kept")
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(installer.GetInstallPath(conf, spec)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := filepath.Base(installer.GetInstallPath(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.1.0"}))
+	for _, entry := range entries {
+		if entry.Name() != kept {
+			t.Errorf("expected no leftover staging dir, found %s", entry.Name())
+		}
+	}
+
+	if err := installer.Uninstall(conf, spec); !errors.Is(err, installer.ErrNotInstalled) {
+		t.Errorf("expected ErrNotInstalled, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package installer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+// MarkUsed records that spec was just run. The complete marker's mtime is
+// the last-used time; its contents keep the install time.
+func MarkUsed(conf *config.Config, spec inspector.PackageManagerSpec) error {
+	now := time.Now()
+	return os.Chtimes(filepath.Join(GetInstallPath(conf, spec), completeMarker), now, now)
+}
+
+// LastUsed returns when spec was last run, or installed if it never was.
+func LastUsed(conf *config.Config, spec inspector.PackageManagerSpec) (time.Time, error) {
+	installPath := GetInstallPath(conf, spec)
+	info, err := os.Stat(filepath.Join(installPath, completeMarker))
+	if os.IsNotExist(err) {
+		// A legacy install isn't marked until it is next used.
+		info, err = os.Stat(installPath)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// DiskUsage returns the total size of the files in spec's install.
+func DiskUsage(conf *config.Config, spec inspector.PackageManagerSpec) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(GetInstallPath(conf, spec), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
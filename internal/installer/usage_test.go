@@ -0,0 +1,67 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+func TestMarkUsed(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	if err := MarkInstalled(conf, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	marker := filepath.Join(GetInstallPath(conf, spec), completeMarker)
+	if err := os.Chtimes(marker, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MarkUsed(conf, spec); err != nil {
+		t.Fatalf("MarkUsed() error = %v", err)
+	}
+	lastUsed, err := LastUsed(conf, spec)
+	if err != nil {
+		t.Fatalf("LastUsed() error = %v", err)
+	}
+	if time.Since(lastUsed) > time.Minute {
+		t.Errorf("expected LastUsed to be now, got %v", lastUsed)
+	}
+	if !IsInstalled(conf, spec) {
+		t.Error("expected MarkUsed to keep the install intact")
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}
+	if err := MarkInstalled(conf, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	installPath := GetInstallPath(conf, spec)
+	if err := os.MkdirAll(filepath.Join(installPath, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(installPath, "bin", "pnpm.cjs"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	marker, err := os.Stat(filepath.Join(installPath, completeMarker))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := DiskUsage(conf, spec)
+	if err != nil {
+		t.Fatalf("DiskUsage() error = %v", err)
+	}
+	if want := 1000 + marker.Size(); size != want {
+		t.Errorf("DiskUsage() = %d, want %d", size, want)
+	}
+}
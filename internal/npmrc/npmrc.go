@@ -0,0 +1,270 @@
+package npmrc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Config holds the merged settings of the user and project .npmrc files,
+// with project settings taking precedence.
+type Config struct {
+	values map[string]string
+	// lists holds "key[]=" entries, which npm treats as arrays.
+	lists map[string][]string
+}
+
+var envRe = regexp.MustCompile(`\$\{([^}?]+)\??\}`)
+
+// Load reads the user .npmrc (NPM_CONFIG_USERCONFIG or ~/.npmrc) and the
+// .npmrc of the project containing cwd. Missing files are skipped.
+func Load(cwd, home string) *Config {
+	c := newConfig()
+
+	userConfig := os.Getenv("NPM_CONFIG_USERCONFIG")
+	if userConfig == "" {
+		userConfig = os.Getenv("npm_config_userconfig")
+	}
+	if userConfig == "" && home != "" {
+		userConfig = filepath.Join(home, ".npmrc")
+	}
+	if userConfig != "" {
+		c.loadFile(userConfig)
+	}
+
+	if root := findProjectRoot(cwd); root != "" {
+		projectConfig := filepath.Join(root, ".npmrc")
+		if projectConfig != userConfig {
+			c.loadFile(projectConfig)
+		}
+	}
+
+	return c
+}
+
+// Parse reads .npmrc contents into a Config.
+func Parse(data []byte) *Config {
+	c := newConfig()
+	c.parse(data)
+	return c
+}
+
+func newConfig() *Config {
+	return &Config{values: map[string]string{}, lists: map[string][]string{}}
+}
+
+// findProjectRoot mirrors npm's local prefix: the nearest directory with a
+// package.json or node_modules.
+func findProjectRoot(cwd string) string {
+	if cwd == "" {
+		return ""
+	}
+	current := cwd
+	for {
+		for _, marker := range []string{"package.json", "node_modules"} {
+			if _, err := os.Stat(filepath.Join(current, marker)); err == nil {
+				return current
+			}
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return ""
+		}
+		current = parent
+	}
+}
+
+func (c *Config) loadFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	c.parse(data)
+}
+
+func (c *Config) parse(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = expandEnv(strings.TrimSpace(key))
+		value = expandEnv(unquote(strings.TrimSpace(value)))
+		if name, ok := strings.CutSuffix(key, "[]"); ok {
+			c.lists[name] = append(c.lists[name], value)
+			continue
+		}
+		c.values[key] = value
+	}
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// expandEnv replaces ${VAR} (and the optional form ${VAR?}) with the
+// environment variable's value.
+func expandEnv(value string) string {
+	return envRe.ReplaceAllStringFunc(value, func(match string) string {
+		return os.Getenv(envRe.FindStringSubmatch(match)[1])
+	})
+}
+
+func (c *Config) Get(key string) string {
+	if c == nil {
+		return ""
+	}
+	return c.values[key]
+}
+
+// Registry returns the registry= setting, or "" if unset.
+func (c *Config) Registry() string {
+	return c.Get("registry")
+}
+
+// ScopeRegistry returns the @scope:registry= setting for the package's
+// scope, or "" if pkgName is unscoped or the scope has no registry.
+func (c *Config) ScopeRegistry(pkgName string) string {
+	if !strings.HasPrefix(pkgName, "@") {
+		return ""
+	}
+	scope, _, _ := strings.Cut(pkgName, "/")
+	return c.Get(scope + ":registry")
+}
+
+// CA returns the PEM certificates given inline with ca= or ca[]=.
+func (c *Config) CA() []string {
+	if c == nil {
+		return nil
+	}
+	var certs []string
+	if ca := c.values["ca"]; ca != "" {
+		certs = append(certs, ca)
+	}
+	certs = append(certs, c.lists["ca"]...)
+	for i, cert := range certs {
+		// .npmrc files carry PEM blocks on a single line with "\n" escapes.
+		certs[i] = strings.ReplaceAll(cert, `\n`, "\n")
+	}
+	return certs
+}
+
+// ClientCertificate returns the PEM client certificate and key to present to
+// host. Files scoped with "//host/:certfile=" and ":keyfile=" take precedence
+// over unscoped certfile=/keyfile= and the inline cert=/key= settings.
+func (c *Config) ClientCertificate(host string) (certPEM, keyPEM []byte, err error) {
+	if c == nil {
+		return nil, nil, nil
+	}
+	for _, prefix := range []string{"//" + host + "/:", ""} {
+		certFile, keyFile := c.values[prefix+"certfile"], c.values[prefix+"keyfile"]
+		if certFile == "" || keyFile == "" {
+			continue
+		}
+		if certPEM, err = os.ReadFile(certFile); err != nil {
+			return nil, nil, err
+		}
+		if keyPEM, err = os.ReadFile(keyFile); err != nil {
+			return nil, nil, err
+		}
+		return certPEM, keyPEM, nil
+	}
+
+	cert, key := c.values["cert"], c.values["key"]
+	if cert != "" && key != "" {
+		return []byte(strings.ReplaceAll(cert, `\n`, "\n")), []byte(strings.ReplaceAll(key, `\n`, "\n")), nil
+	}
+	return nil, nil, nil
+}
+
+// AuthHeader returns the Authorization header to send with a request to
+// rawURL, or "" if no credentials apply. Credentials scoped with a
+// "//host/path/:" prefix apply to URLs below that prefix. Unscoped ones
+// only ever apply to URLs below defaultRegistry, so they never reach scoped
+// registries, tarball hosts or fallback mirrors. pmm2 always authenticates
+// to defaultRegistry, which is all always-auth asks for.
+func (c *Config) AuthHeader(rawURL, defaultRegistry string) string {
+	if c == nil {
+		return ""
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	for _, prefix := range nerfDarts(u) {
+		if header := c.authFor(prefix + ":"); header != "" {
+			return header
+		}
+	}
+
+	if isBelow(u, defaultRegistry) {
+		return c.authFor("")
+	}
+	return ""
+}
+
+// nerfDarts lists the "//host/path/" keys that may hold credentials for u,
+// most specific first.
+func nerfDarts(u *url.URL) []string {
+	path := u.Path
+	if idx := strings.LastIndex(path, "/"); idx != -1 {
+		path = path[:idx+1]
+	} else {
+		path = "/"
+	}
+
+	var darts []string
+	for {
+		darts = append(darts, "//"+u.Host+path)
+		if path == "/" {
+			break
+		}
+		path = path[:strings.LastIndex(strings.TrimSuffix(path, "/"), "/")+1]
+	}
+	return darts
+}
+
+// isBelow reports whether u is registry or below it, comparing whole path
+// segments so that /npm doesn't cover /npm-other.
+func isBelow(u *url.URL, registry string) bool {
+	r, err := url.Parse(registry)
+	if err != nil || r.Host == "" || u.Scheme != r.Scheme || u.Host != r.Host {
+		return false
+	}
+	base := strings.TrimSuffix(r.Path, "/")
+	return u.Path == base || strings.HasPrefix(u.Path, base+"/")
+}
+
+func (c *Config) authFor(prefix string) string {
+	if token := c.values[prefix+"_authToken"]; token != "" {
+		return "Bearer " + token
+	}
+	if auth := c.values[prefix+"_auth"]; auth != "" {
+		return "Basic " + auth
+	}
+	username := c.values[prefix+"username"]
+	password := c.values[prefix+"_password"]
+	if username != "" && password != "" {
+		decoded, err := base64.StdEncoding.DecodeString(password)
+		if err != nil {
+			return ""
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+string(decoded)))
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package npmrc
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("NPM_TOKEN", "s3cr3t")
+
+	c := Parse([]byte(`
+; comment
+# another comment
+registry = "https://npm.example.com/artifactory/api/npm/npm/"
+@yarnpkg:registry=https://yarn.example.com/
+//npm.example.com/artifactory/api/npm/npm/:_authToken=${NPM_TOKEN}
+always-auth=true
+`))
+
+	if got := c.Registry(); got != "https://npm.example.com/artifactory/api/npm/npm/" {
+		t.Errorf("Registry() = %s", got)
+	}
+	if got := c.ScopeRegistry("@yarnpkg/cli-dist"); got != "https://yarn.example.com/" {
+		t.Errorf("ScopeRegistry() = %s", got)
+	}
+	if got := c.ScopeRegistry("pnpm"); got != "" {
+		t.Errorf("expected no scope registry for unscoped package, got %s", got)
+	}
+	if got := c.Get("//npm.example.com/artifactory/api/npm/npm/:_authToken"); got != "s3cr3t" {
+		t.Errorf("expected ${NPM_TOKEN} to be expanded, got %q", got)
+	}
+	if c.Get("always-auth") != "true" {
+		t.Error("expected always-auth to be true")
+	}
+}
+
+func TestAuthHeader(t *testing.T) {
+	password := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+	c := Parse([]byte(`
+//npm.example.com/artifactory/api/npm/npm/:_authToken=scoped-token
+//other.example.com/:username=alice
+//other.example.com/:_password=` + password + `
+_auth=ZGVmYXVsdDpjcmVkcw==
+`))
+
+	tests := []struct {
+		name     string
+		url      string
+		registry string
+		expected string
+	}{
+		{"path scoped token", "https://npm.example.com/artifactory/api/npm/npm/pnpm", "https://registry.npmjs.org", "Bearer scoped-token"},
+		{"path scoped token for tarball", "https://npm.example.com/artifactory/api/npm/npm/pnpm/-/pnpm-9.0.0.tgz", "https://registry.npmjs.org", "Bearer scoped-token"},
+		{"outside scoped path", "https://npm.example.com/other/pnpm", "https://registry.npmjs.org", ""},
+		{"username and password", "https://other.example.com/pnpm", "https://registry.npmjs.org", "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:hunter2"))},
+		{"unscoped for default registry", "https://registry.example.com/npm/pnpm", "https://registry.example.com/npm", "Basic ZGVmYXVsdDpjcmVkcw=="},
+		{"unscoped not sent elsewhere", "https://evil.example.com/pnpm", "https://registry.example.com/npm", ""},
+		{"unscoped not sent to sibling path", "https://registry.example.com/npm-other/pnpm", "https://registry.example.com/npm", ""},
+		{"unscoped not sent over http", "http://registry.example.com/npm/pnpm", "https://registry.example.com/npm", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.AuthHeader(tt.url, tt.registry); got != tt.expected {
+				t.Errorf("AuthHeader(%s) = %q, want %q", tt.url, got, tt.expected)
+			}
+		})
+	}
+
+	c.values["always-auth"] = "true"
+	for _, url := range []string{"https://mirror.example.com/pnpm", "https://registry.npmjs.org/pnpm"} {
+		if got := c.AuthHeader(url, "https://registry.example.com/npm"); got != "" {
+			t.Errorf("expected always-auth not to send unscoped credentials to %s, got %q", url, got)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	home := t.TempDir()
+	project := t.TempDir()
+	t.Setenv("NPM_CONFIG_USERCONFIG", "")
+	t.Setenv("npm_config_userconfig", "")
+
+	if err := os.WriteFile(filepath.Join(home, ".npmrc"), []byte("registry=https://user.example.com/\nalways-auth=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".npmrc"), []byte("registry=https://project.example.com/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cwd := filepath.Join(project, "src")
+	if err := os.Mkdir(cwd, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Load(cwd, home)
+	if got := c.Registry(); got != "https://project.example.com/" {
+		t.Errorf("expected project .npmrc to win, got %s", got)
+	}
+	if c.Get("always-auth") != "true" {
+		t.Error("expected user .npmrc settings to be kept")
+	}
+}
@@ -0,0 +1,218 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+// The policy modes. ModeError is the default.
+const (
+	ModeWarn  = "warn"
+	ModeError = "error"
+)
+
+// Policy is an organization's rules for which package manager versions may
+// run, keyed by package manager name.
+//
+//	{
+//	  "mode": "error",
+//	  "packageManagers": {
+//	    "pnpm": {
+//	      "allowed": ">=8 <11",
+//	      "minimum": "8.15.6",
+//	      "blocked": {"9.1.0": "CVE-2024-1234, upgrade to 9.1.1"}
+//	    }
+//	  }
+//	}
+type Policy struct {
+	Mode            string          `json:"mode"`
+	PackageManagers map[string]Rule `json:"packageManagers"`
+	// Path is the file the policy was read from.
+	Path string `json:"-"`
+}
+
+// Rule restricts one package manager. Blocked maps versions or ranges to
+// the reason they are blocked. Reason explains Allowed and Minimum.
+type Rule struct {
+	Allowed string            `json:"allowed"`
+	Minimum string            `json:"minimum"`
+	Blocked map[string]string `json:"blocked"`
+	Reason  string            `json:"reason"`
+}
+
+// Violation is a version the policy doesn't allow.
+type Violation struct {
+	Spec   inspector.PackageManagerSpec
+	Reason string
+	Path   string
+}
+
+func (e *Violation) Error() string {
+	return fmt.Sprintf("⚠️  %s@%s %s.\nSee %s\n\nYou can ignore the policy by setting the environment variable PMM_IGNORE_POLICY=1", e.Spec.Name, e.Spec.Version, e.Reason, e.Path)
+}
+
+// GetPolicyPath returns the policy file conf points at.
+func GetPolicyPath(conf *config.Config) string {
+	if conf.PolicyFile != "" {
+		return conf.PolicyFile
+	}
+	return filepath.Join(conf.PmmDir, "policy.json")
+}
+
+// Load reads and validates the policy. Without one at PmmDir/policy.json it
+// returns nil, but a PMM_POLICY_FILE that doesn't exist is an error rather
+// than a silently missing policy.
+func Load(conf *config.Config) (*Policy, error) {
+	path := GetPolicyPath(conf)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && conf.PolicyFile == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	policy := &Policy{Path: path}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid policy in %s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy in %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func (p *Policy) validate() error {
+	switch p.Mode {
+	case "":
+		p.Mode = ModeError
+	case ModeWarn, ModeError:
+	default:
+		return fmt.Errorf("unknown mode %q, expected %q or %q", p.Mode, ModeWarn, ModeError)
+	}
+
+	for name, rule := range p.PackageManagers {
+		if !config.IsSupported(name) {
+			return fmt.Errorf("unsupported package manager: %s", name)
+		}
+		if rule.Allowed != "" {
+			if _, err := semver.NewConstraint(rule.Allowed); err != nil {
+				return fmt.Errorf("%s: invalid allowed range %s: %w", name, rule.Allowed, err)
+			}
+		}
+		if rule.Minimum != "" {
+			if _, err := semver.NewVersion(rule.Minimum); err != nil {
+				return fmt.Errorf("%s: invalid minimum version %s: %w", name, rule.Minimum, err)
+			}
+		}
+		for blocked := range rule.Blocked {
+			if _, err := semver.NewConstraint(blocked); err != nil {
+				return fmt.Errorf("%s: invalid blocked version %s: %w", name, blocked, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns a Violation if the policy doesn't allow spec, which must be
+// an exact version.
+func (p *Policy) Check(spec inspector.PackageManagerSpec) error {
+	rule, ok := p.PackageManagers[spec.Name]
+	if !ok {
+		return nil
+	}
+	version, err := semver.NewVersion(spec.Version)
+	if err != nil {
+		return fmt.Errorf("invalid version %s: %w", spec.Version, err)
+	}
+
+	violation := func(reason, detail string) error {
+		if detail != "" {
+			reason += ": " + strings.TrimSuffix(detail, ".")
+		}
+		return &Violation{Spec: spec, Reason: reason, Path: p.Path}
+	}
+
+	for _, blocked := range slices.Sorted(maps.Keys(rule.Blocked)) {
+		// Validated by Load.
+		if constraint, _ := semver.NewConstraint(blocked); constraint != nil && blocks(constraint, version) {
+			return violation("is blocked by policy", rule.Blocked[blocked])
+		}
+	}
+	if rule.Minimum != "" && version.LessThan(semver.MustParse(rule.Minimum)) {
+		return violation(fmt.Sprintf("is below the minimum version %s allowed by policy", rule.Minimum), rule.Reason)
+	}
+	if rule.Allowed != "" {
+		if constraint, _ := semver.NewConstraint(rule.Allowed); constraint != nil && !constraint.Check(version) {
+			return violation(fmt.Sprintf("is outside the range %q allowed by policy", rule.Allowed), rule.Reason)
+		}
+	}
+	return nil
+}
+
+// blocks reports whether a blocked range covers version. Unlike semver
+// ranges in general, it covers prereleases too: 9.0.x blocks 9.0.0-rc.1,
+// which sorts below 9.0.0, as well as 9.0.1-rc.1.
+func blocks(constraint *semver.Constraints, version *semver.Version) bool {
+	if version.Prerelease() == "" {
+		return constraint.Check(version)
+	}
+	constraint.IncludePrerelease = true
+	release, _ := version.SetPrerelease("")
+	return constraint.Check(version) || constraint.Check(&release)
+}
+
+// Enforce checks spec against the policy. In warn mode violations are
+// printed and nil is returned. PMM_IGNORE_POLICY skips the policy entirely.
+func Enforce(conf *config.Config, spec inspector.PackageManagerSpec) error {
+	if conf.IgnorePolicy {
+		return nil
+	}
+	policy, err := Load(conf)
+	if err != nil || policy == nil {
+		return err
+	}
+
+	err = policy.Check(spec)
+	var violation *Violation
+	if errors.As(err, &violation) && policy.Mode == ModeWarn {
+		fmt.Fprintf(os.Stderr, "%v\n\n", violation)
+		return nil
+	}
+	return err
+}
+
+// EnforceUnknown is Enforce for a release of name whose version can't be
+// told, such as a yarnPath release not named yarn-X.Y.Z.cjs. If the policy
+// has a rule for name the release can't be checked, which is an error unless
+// the policy is in warn mode.
+func EnforceUnknown(conf *config.Config, name, path string) error {
+	if conf.IgnorePolicy {
+		return nil
+	}
+	policy, err := Load(conf)
+	if err != nil || policy == nil {
+		return err
+	}
+	if _, ok := policy.PackageManagers[name]; !ok {
+		return nil
+	}
+
+	err = fmt.Errorf("⚠️  Can't check %s against the %s policy because its version is unknown.\nSee %s\n\nYou can ignore the policy by setting the environment variable PMM_IGNORE_POLICY=1", path, name, policy.Path)
+	if policy.Mode == ModeWarn {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+const testPolicy = `{
+  "packageManagers": {
+    "pnpm": {
+      "allowed": ">=8 <11",
+      "minimum": "8.15.6",
+      "reason": "older releases mishandle our workspace protocol",
+      "blocked": {"9.1.0": "CVE-2024-1234, upgrade to 9.1.1", "10.0.x": "breaks our lockfile"}
+    }
+  }
+}`
+
+func writePolicy(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheck(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	writePolicy(t, conf.PmmDir, testPolicy)
+
+	policy, err := Load(conf)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if policy.Mode != ModeError {
+		t.Errorf("expected default mode %s, got %s", ModeError, policy.Mode)
+	}
+
+	tests := []struct {
+		spec   string
+		reason string
+	}{
+		{"pnpm@9.12.0", ""},
+		{"pnpm@8.15.6", ""},
+		{"pnpm@9.1.0", "is blocked by policy: CVE-2024-1234, upgrade to 9.1.1"},
+		{"pnpm@10.0.3", "is blocked by policy: breaks our lockfile"},
+		{"pnpm@10.0.0-rc.1", "is blocked by policy: breaks our lockfile"},
+		{"pnpm@10.0.2-beta.0", "is blocked by policy: breaks our lockfile"},
+		{"pnpm@9.1.0-rc.0", "is blocked by policy: CVE-2024-1234, upgrade to 9.1.1"},
+		{"pnpm@8.15.5", "is below the minimum version 8.15.6 allowed by policy: older releases mishandle our workspace protocol"},
+		{"pnpm@11.0.0", `is outside the range ">=8 <11" allowed by policy: older releases mishandle our workspace protocol`},
+		{"npm@6.0.0", ""},
+	}
+
+	for _, tt := range tests {
+		spec, err := inspector.ParseSpecString(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = policy.Check(spec)
+		var violation *Violation
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Errorf("Check(%s) error = %v, want nil", tt.spec, err)
+		case tt.reason != "" && !errors.As(err, &violation):
+			t.Errorf("Check(%s) error = %v, want a violation", tt.spec, err)
+		case tt.reason != "" && violation.Reason != tt.reason:
+			t.Errorf("Check(%s) reason = %q, want %q", tt.spec, violation.Reason, tt.reason)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	conf := &config.Config{PmmDir: t.TempDir()}
+	if policy, err := Load(conf); policy != nil || err != nil {
+		t.Errorf("expected no policy without a policy file, got %v, %v", policy, err)
+	}
+
+	conf.PolicyFile = filepath.Join(conf.PmmDir, "missing.json")
+	if _, err := Load(conf); err == nil {
+		t.Error("expected an error for a missing PMM_POLICY_FILE")
+	}
+
+	for _, content := range []string{
+		`{"mode": "strict"}`,
+		`{"packageManagers": {"deno": {}}}`,
+		`{"packageManagers": {"pnpm": {"allowed": "bogus"}}}`,
+		`{"packageManagers": {"pnpm": {"minimum": "8"}}}x`,
+	} {
+		conf.PolicyFile = writePolicy(t, t.TempDir(), content)
+		if _, err := Load(conf); err == nil || !strings.Contains(err.Error(), "invalid policy") {
+			t.Errorf("Load(%s) error = %v, want invalid policy", content, err)
+		}
+	}
+}
+
+func TestEnforce(t *testing.T) {
+	dir := t.TempDir()
+	blocked := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.1.0"}
+
+	conf := &config.Config{PolicyFile: writePolicy(t, dir, testPolicy)}
+	if err := Enforce(conf, blocked); err == nil {
+		t.Error("expected a blocked version to be an error")
+	}
+
+	conf.IgnorePolicy = true
+	if err := Enforce(conf, blocked); err != nil {
+		t.Errorf("expected PMM_IGNORE_POLICY to skip the policy, got %v", err)
+	}
+
+	warn := strings.Replace(testPolicy, "{", `{"mode": "warn",`, 1)
+	conf = &config.Config{PolicyFile: writePolicy(t, t.TempDir(), warn)}
+	if err := Enforce(conf, blocked); err != nil {
+		t.Errorf("expected warn mode to allow a blocked version, got %v", err)
+	}
+}
+
+func TestEnforceUnknown(t *testing.T) {
+	conf := &config.Config{PolicyFile: writePolicy(t, t.TempDir(), `{"packageManagers": {"yarn": {"minimum": "4.0.0"}}}`)}
+	if err := EnforceUnknown(conf, "yarn", ".yarn/releases/yarn.cjs"); err == nil || !strings.Contains(err.Error(), "version is unknown") {
+		t.Errorf("expected an unknown yarn version to fail the policy, got %v", err)
+	}
+	if err := EnforceUnknown(conf, "pnpm", "pnpm.cjs"); err != nil {
+		t.Errorf("expected no error without a rule for pnpm, got %v", err)
+	}
+
+	conf.PolicyFile = writePolicy(t, t.TempDir(), `{"mode": "warn", "packageManagers": {"yarn": {"minimum": "4.0.0"}}}`)
+	if err := EnforceUnknown(conf, "yarn", ".yarn/releases/yarn.cjs"); err != nil {
+		t.Errorf("expected warn mode to allow an unknown version, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+)
+
+// abbreviatedAccept asks for the install-v1 packument, which only carries
+// what installers need and is a fraction of the size of the full document.
+const abbreviatedAccept = "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8, */*"
+
+// packumentFormat is a packument representation and where it is cached.
+type packumentFormat struct {
+	accept string
+	suffix string
+}
+
+var (
+	abbreviatedFormat = packumentFormat{accept: abbreviatedAccept, suffix: ".json"}
+	// fullFormat is only needed for fields such as time, which the
+	// abbreviated packument leaves out.
+	fullFormat = packumentFormat{accept: "application/json", suffix: ".full.json"}
+)
+
+// cachedPackument is a packument as stored under PmmDir, with the
+// validators needed to revalidate it.
+type cachedPackument struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"lastModified,omitempty"`
+	FetchedAt    time.Time       `json:"fetchedAt"`
+	Packument    json.RawMessage `json:"packument"`
+}
+
+func (c *cachedPackument) fresh(ttl time.Duration) bool {
+	return time.Since(c.FetchedAt) < ttl
+}
+
+// getPackumentCachePath keys the cache by registry as well as package, as
+// each registry's packument points at its own tarballs and may lag behind.
+func getPackumentCachePath(conf *config.Config, registry, pkgName string, format packumentFormat) string {
+	return filepath.Join(conf.PmmDir, "cache", "packuments", url.PathEscape(registry), url.PathEscape(pkgName)+format.suffix)
+}
+
+func readPackumentCache(conf *config.Config, registry, pkgName string, format packumentFormat) *cachedPackument {
+	if conf.PmmDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(getPackumentCachePath(conf, registry, pkgName, format))
+	if err != nil {
+		return nil
+	}
+	var cached cachedPackument
+	if err := json.Unmarshal(data, &cached); err != nil || len(cached.Packument) == 0 {
+		return nil
+	}
+	return &cached
+}
+
+// writePackumentCache is best effort; a failed write only costs a full
+// fetch next time.
+func writePackumentCache(conf *config.Config, registry, pkgName string, format packumentFormat, cached *cachedPackument) {
+	if conf.PmmDir == "" {
+		return
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	path := getPackumentCachePath(conf, registry, pkgName, format)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".packument-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || os.Rename(tmp.Name(), path) != nil {
+		os.Remove(tmp.Name())
+	}
+}
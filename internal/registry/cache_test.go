@@ -0,0 +1,213 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+)
+
+// revalidatingServer serves a packument with an ETag and answers 304 to
+// matching conditional requests.
+func revalidatingServer(t *testing.T) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Accept") != abbreviatedAccept {
+			t.Errorf("unexpected Accept header %q", r.Header.Get("Accept"))
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/vnd.npm.install-v1+json")
+		fmt.Fprint(w, `{"dist-tags": {"latest": "9.0.0"}, "versions": {"9.0.0": {"dist": {"shasum": "abc"}}}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests, &notModified
+}
+
+func TestGetPackument_FreshCache(t *testing.T) {
+	server, requests, _ := revalidatingServer(t)
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), MetadataTTL: time.Hour}
+
+	for range 3 {
+		packument, err := GetPackument(conf, "pnpm")
+		if err != nil {
+			t.Fatalf("GetPackument() error = %v", err)
+		}
+		if packument.Versions["9.0.0"].Dist.Shasum != "abc" {
+			t.Errorf("unexpected packument %+v", packument)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected a single request within the TTL, got %d", n)
+	}
+}
+
+func TestGetPackument_Revalidates(t *testing.T) {
+	server, requests, notModified := revalidatingServer(t)
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+
+	if _, err := GetPackument(conf, "pnpm"); err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	first := readPackumentCache(conf, server.URL, "pnpm", abbreviatedFormat)
+	if first == nil {
+		t.Fatal("expected packument to be cached")
+	}
+
+	packument, err := GetPackument(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("GetPackument() after expiry error = %v", err)
+	}
+	if packument.DistTags["latest"] != "9.0.0" {
+		t.Errorf("expected cached latest 9.0.0, got %s", packument.DistTags["latest"])
+	}
+	if requests.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("expected one conditional request answered 304, got %d requests, %d not modified", requests.Load(), notModified.Load())
+	}
+
+	cached := readPackumentCache(conf, server.URL, "pnpm", abbreviatedFormat)
+	if cached == nil || cached.ETag != `"v1"` {
+		t.Fatalf("expected cached ETag, got %+v", cached)
+	}
+	if !cached.FetchedAt.After(first.FetchedAt) {
+		t.Error("expected revalidation to refresh the cache entry")
+	}
+}
+
+func TestGetPackument_IfModifiedSince(t *testing.T) {
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	var conditional atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		packumentHandler(w, r)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	for range 2 {
+		if _, err := GetPackument(conf, "pnpm"); err != nil {
+			t.Fatalf("GetPackument() error = %v", err)
+		}
+	}
+	if conditional.Load() != 1 {
+		t.Errorf("expected one If-Modified-Since revalidation, got %d", conditional.Load())
+	}
+}
+
+func TestGetFullPackument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == abbreviatedAccept {
+			packumentHandler(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"dist-tags": {"latest": "9.0.0"}, "time": {"created": "2016-01-01T00:00:00.000Z", "9.0.0": "2024-04-15T10:00:00.000Z"}}`)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), MetadataTTL: time.Hour}
+	if _, err := GetPackument(conf, "pnpm"); err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	full, err := GetFullPackument(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("GetFullPackument() error = %v", err)
+	}
+	if want := time.Date(2024, 4, 15, 10, 0, 0, 0, time.UTC); !full.Time["9.0.0"].Equal(want) {
+		t.Errorf("expected publish time %v, got %v", want, full.Time["9.0.0"])
+	}
+
+	// The formats are cached separately, so the abbreviated copy can't
+	// stand in for the full one.
+	abbreviated, err := GetPackument(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	if abbreviated.Time != nil {
+		t.Errorf("expected abbreviated packument without time, got %v", abbreviated.Time)
+	}
+}
+
+func TestGetPackument_CachedPerRegistry(t *testing.T) {
+	serve := func(latest string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"dist-tags": {"latest": %q}, "versions": {%q: {}}}`, latest, latest)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	mirror, other := serve("9.0.0"), serve("9.1.0")
+	pmmDir := t.TempDir()
+
+	// A mirror's answer is cached as the mirror's, not the primary's.
+	failover := &config.Config{Registry: down.URL, FallbackRegistries: []string{mirror.URL}, PmmDir: pmmDir, MetadataTTL: time.Hour}
+	if _, err := GetPackument(failover, "pnpm"); err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	if readPackumentCache(failover, down.URL, "pnpm", abbreviatedFormat) != nil {
+		t.Error("expected the mirror's packument not to be cached for the primary")
+	}
+	if readPackumentCache(failover, mirror.URL, "pnpm", abbreviatedFormat) == nil {
+		t.Error("expected the mirror's packument to be cached")
+	}
+
+	// Switching registry doesn't serve the previous one's fresh copy.
+	switched := &config.Config{Registry: other.URL, PmmDir: pmmDir, MetadataTTL: time.Hour}
+	packument, err := GetPackument(switched, "pnpm")
+	if err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	if packument.DistTags["latest"] != "9.1.0" {
+		t.Errorf("expected latest 9.1.0 from the new registry, got %s", packument.DistTags["latest"])
+	}
+}
+
+func TestGetDist_RevalidatesMissingVersion(t *testing.T) {
+	var published atomic.Bool
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if published.Load() {
+			fmt.Fprint(w, `{"versions": {"9.0.0": {"dist": {"shasum": "abc"}}, "9.1.0": {"dist": {"shasum": "def"}}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"versions": {"9.0.0": {"dist": {"shasum": "abc"}}}}`)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), MetadataTTL: time.Hour}
+	if _, err := GetPackument(conf, "pnpm"); err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	published.Store(true)
+
+	dist, err := GetDist(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.1.0"})
+	if err != nil {
+		t.Fatalf("GetDist() error = %v", err)
+	}
+	if dist.Shasum != "def" {
+		t.Errorf("unexpected dist %+v", dist)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected the fresh cache to be revalidated once, got %d requests", n)
+	}
+}
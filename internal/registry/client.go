@@ -0,0 +1,270 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+)
+
+// clients holds one *http.Client per *config.Config, so connections are
+// reused and CA bundles are only read once per process.
+var clients sync.Map
+
+func getClient(conf *config.Config) *http.Client {
+	if client, ok := clients.Load(conf); ok {
+		return client.(*http.Client)
+	}
+
+	client := &http.Client{
+		Transport: &hostTransport{conf: conf, base: newTLSConfig(conf), transports: map[string]*http.Transport{}},
+	}
+
+	actual, _ := clients.LoadOrStore(conf, client)
+	return actual.(*http.Client)
+}
+
+// newTLSConfig trusts the system roots plus the CAs from conf.CAFiles and
+// the ca=/ca[]= settings in .npmrc. Like node with a bad
+// NODE_EXTRA_CA_CERTS, a CA source that is missing or holds no certificates
+// is skipped with a warning.
+func newTLSConfig(conf *config.Config) *tls.Config {
+	type caSource struct {
+		name string
+		pem  []byte
+	}
+	var sources []caSource
+	for _, path := range conf.CAFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Ignoring extra CA certificates: %v\n", err)
+			continue
+		}
+		sources = append(sources, caSource{path, data})
+	}
+	for _, ca := range conf.NpmRC.CA() {
+		sources = append(sources, caSource{"ca in .npmrc", []byte(ca)})
+	}
+	if len(sources) == 0 {
+		return &tls.Config{}
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, source := range sources {
+		if !pool.AppendCertsFromPEM(source.pem) {
+			fmt.Fprintf(os.Stderr, "⚠️  Ignoring extra CA certificates: no certificates found in %s\n", source.name)
+		}
+	}
+	return &tls.Config{RootCAs: pool}
+}
+
+// hostTransport keeps a transport per host, because each registry host can
+// have its own client certificate in .npmrc.
+type hostTransport struct {
+	conf       *config.Config
+	base       *tls.Config
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := t.transportFor(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+func (t *hostTransport) transportFor(host string) (*http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if transport, ok := t.transports[host]; ok {
+		return transport, nil
+	}
+
+	tlsConfig := t.base.Clone()
+	certPEM, keyPEM, err := t.conf.NpmRC.ClientCertificate(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate for %s: %w", host, err)
+	}
+	if certPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate for %s: %w", host, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout(t.conf), KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = connectTimeout(t.conf)
+	transport.ResponseHeaderTimeout = readTimeout(t.conf)
+	transport.TLSClientConfig = tlsConfig
+	t.transports[host] = transport
+	return transport, nil
+}
+
+func connectTimeout(conf *config.Config) time.Duration {
+	if conf.ConnectTimeout > 0 {
+		return conf.ConnectTimeout
+	}
+	return config.DefaultConnectTimeout
+}
+
+func readTimeout(conf *config.Config) time.Duration {
+	if conf.ReadTimeout > 0 {
+		return conf.ReadTimeout
+	}
+	return config.DefaultReadTimeout
+}
+
+// retryBaseDelay is the first backoff step; each retry doubles it. Tests
+// shrink it to keep flaky-server cases fast.
+var retryBaseDelay = 500 * time.Millisecond
+
+// maxRetryDelay caps both the backoff and any Retry-After the server asks
+// for, so a misbehaving registry can't stall pmm2 indefinitely.
+const maxRetryDelay = 30 * time.Second
+
+// get performs a GET with the shared client, retrying connection failures,
+// 429s and 5xx responses up to conf.HTTPRetries times. The returned body
+// fails if no data arrives for conf.ReadTimeout.
+func get(conf *config.Config, url string, header http.Header) (*http.Response, error) {
+	client := getClient(conf)
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("User-Agent", conf.UserAgent)
+
+		resp, err := client.Do(req)
+		if attempt < conf.HTTPRetries && shouldRetry(resp, err) {
+			delay := backoff(attempt)
+			if resp != nil {
+				if after, ok := retryAfter(resp); ok {
+					delay = after
+				}
+				io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+				resp.Body.Close()
+			}
+			cancel()
+			time.Sleep(delay)
+			continue
+		}
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		resp.Body = newIdleTimeoutBody(resp.Body, readTimeout(conf), cancel)
+		return resp, nil
+	}
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		// Dial and connection-level failures are transient; TLS verification
+		// and malformed URLs are not.
+		var opErr *net.OpError
+		var netErr net.Error
+		return errors.As(err, &opErr) ||
+			(errors.As(err, &netErr) && netErr.Timeout()) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns an exponential delay with full jitter.
+func backoff(attempt int) time.Duration {
+	ceiling := retryBaseDelay << attempt
+	if ceiling <= 0 || ceiling > maxRetryDelay {
+		ceiling = maxRetryDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryAfter reads a Retry-After header given either in seconds or as an
+// HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = time.Until(at)
+	} else {
+		return 0, false
+	}
+	return min(max(delay, 0), maxRetryDelay), true
+}
+
+// idleTimeoutBody cancels the request when the body goes quiet for longer
+// than timeout, so a stalled download fails instead of hanging.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	return &idleTimeoutBody{
+		ReadCloser: body,
+		timer:      time.AfterFunc(timeout, cancel),
+		timeout:    timeout,
+		cancel:     cancel,
+	}
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	if err != nil && !errors.Is(err, io.EOF) && !b.timer.Stop() {
+		return n, fmt.Errorf("no data received for %s: %w", b.timeout, err)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/npmrc"
+)
+
+func packumentHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, `{"dist-tags": {"latest": "9.0.0"}}`)
+}
+
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetClient_CAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(packumentHandler))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL}
+	if _, err := GetLatestVersion(conf, "pnpm"); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expected certificate error without CA, got %v", err)
+	}
+
+	conf = &config.Config{Registry: server.URL, CAFiles: []string{writeServerCA(t, server)}}
+	if _, err := GetLatestVersion(conf, "pnpm"); err != nil {
+		t.Fatalf("GetLatestVersion() with CA file error = %v", err)
+	}
+}
+
+func TestGetClient_NpmrcCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(packumentHandler))
+	defer server.Close()
+
+	data, err := os.ReadFile(writeServerCA(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inline := strings.ReplaceAll(strings.TrimSpace(string(data)), "\n", `\n`)
+
+	conf := &config.Config{Registry: server.URL, NpmRC: npmrc.Parse([]byte(`ca[]="` + inline + `"`))}
+	if _, err := GetLatestVersion(conf, "pnpm"); err != nil {
+		t.Fatalf("GetLatestVersion() with ca[] error = %v", err)
+	}
+}
+
+func TestGetClient_InvalidCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(packumentHandler))
+	defer server.Close()
+
+	invalid := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(invalid, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	// Bad sources are skipped rather than failing every request.
+	conf := &config.Config{Registry: server.URL, CAFiles: []string{missing, invalid, writeServerCA(t, server)}}
+	if _, err := GetLatestVersion(conf, "pnpm"); err != nil {
+		t.Fatalf("GetLatestVersion() with bad CA files error = %v", err)
+	}
+
+	conf = &config.Config{Registry: server.URL, CAFiles: []string{missing, invalid}}
+	if _, err := GetLatestVersion(conf, "pnpm"); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expected certificate error with only bad CA files, got %v", err)
+	}
+}
+
+// newClientCertificate creates a self-signed client certificate, returning
+// the paths of its PEM certificate and key.
+func newClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pmm2-test-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client-key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, certPath, keyPath
+}
+
+func TestGetClient_ClientCertificate(t *testing.T) {
+	clientCert, certPath, keyPath := newClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(packumentHandler))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writeServerCA(t, server)
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	conf := &config.Config{Registry: server.URL, CAFiles: []string{caFile}}
+	if _, err := GetLatestVersion(conf, "pnpm"); err == nil {
+		t.Fatal("expected handshake to fail without a client certificate")
+	}
+
+	rc := fmt.Sprintf("//%s/:certfile=%s\n//%s/:keyfile=%s\n", host, certPath, host, keyPath)
+	conf = &config.Config{Registry: server.URL, CAFiles: []string{caFile}, NpmRC: npmrc.Parse([]byte(rc))}
+	if _, err := GetLatestVersion(conf, "pnpm"); err != nil {
+		t.Fatalf("GetLatestVersion() with client certificate error = %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ehyland/pmm2/internal/config"
+)
+
+// ErrOffline is returned when a request needs the network but pmm2 is
+// offline, either via PMM_OFFLINE or after falling back on a network error.
+var ErrOffline = errors.New("pmm2 is offline")
+
+// fellBack records configs that switched to offline mode after a network
+// failure, so the rest of the process doesn't wait on more timeouts.
+var fellBack sync.Map
+
+// IsOffline reports whether registry and download requests are disabled.
+func IsOffline(conf *config.Config) bool {
+	if conf.Offline {
+		return true
+	}
+	_, ok := fellBack.Load(conf)
+	return ok
+}
+
+// offlineError returns ErrOffline when conf is offline, naming what was
+// needed.
+func offlineError(conf *config.Config, what string) error {
+	if IsOffline(conf) {
+		return fmt.Errorf("%w: cannot fetch %s", ErrOffline, what)
+	}
+	return nil
+}
+
+// fallBackOffline switches conf to offline mode when err is a network
+// failure and PMM_OFFLINE_FALLBACK is set. It returns the error to report.
+func fallBackOffline(conf *config.Config, err error) error {
+	if !conf.OfflineFallback || !shouldRetry(nil, err) {
+		return err
+	}
+	if _, loaded := fellBack.LoadOrStore(conf, struct{}{}); !loaded {
+		fmt.Fprintf(os.Stderr, "⚠️  Network unavailable (%v), continuing offline\n", err)
+	}
+	return fmt.Errorf("%w: %v", ErrOffline, err)
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// parsePackument extracts only the fields pmm2 uses. Packuments for npm and
+// friends run to megabytes of readmes, dependencies and maintainers, which
+// gjson skips over without allocating.
+func parsePackument(data []byte) (*Packument, error) {
+	// Fully validating would be a second pass over the document. A
+	// truncated download is what we actually see, and that loses the
+	// closing brace.
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		return nil, errors.New("packument is not a complete JSON object")
+	}
+
+	packument := &Packument{
+		DistTags: map[string]string{},
+		Versions: map[string]PackumentVersion{},
+	}
+	// One pass over the top level: each Get would rescan from the start,
+	// skipping the whole versions object again.
+	gjson.ParseBytes(data).ForEach(func(key, value gjson.Result) bool {
+		switch key.Str {
+		case "dist-tags":
+			value.ForEach(func(tag, version gjson.Result) bool {
+				packument.DistTags[tag.String()] = version.String()
+				return true
+			})
+		case "versions":
+			value.ForEach(func(version, manifest gjson.Result) bool {
+				packument.Versions[version.String()] = parseVersion(manifest)
+				return true
+			})
+		case "time":
+			packument.Time = map[string]time.Time{}
+			value.ForEach(func(version, published gjson.Result) bool {
+				if t, err := time.Parse(time.RFC3339, published.String()); err == nil {
+					packument.Time[version.String()] = t
+				}
+				return true
+			})
+		}
+		return true
+	})
+	return packument, nil
+}
+
+func parseVersion(manifest gjson.Result) PackumentVersion {
+	var v PackumentVersion
+	manifest.ForEach(func(key, value gjson.Result) bool {
+		switch key.Str {
+		case "dist":
+			v.Dist = Dist{
+				Integrity: value.Get("integrity").String(),
+				Shasum:    value.Get("shasum").String(),
+				Tarball:   value.Get("tarball").String(),
+			}
+		case "deprecated":
+			v.Deprecated = value.String()
+		case "engines":
+			// Some old releases publish engines as an array of
+			// strings, which says nothing usable.
+			if value.IsObject() {
+				v.Engines = map[string]string{}
+				value.ForEach(func(engine, rng gjson.Result) bool {
+					v.Engines[engine.String()] = rng.String()
+					return true
+				})
+			}
+		}
+		return true
+	})
+	return v
+}
@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixturePackument builds a full packument shaped like npm's own: every
+// version carries a readme-sized description, dependencies, scripts and
+// maintainers that pmm2 never reads.
+func fixturePackument(tb testing.TB, versions int) []byte {
+	tb.Helper()
+	type manifest struct {
+		Name            string            `json:"name"`
+		Version         string            `json:"version"`
+		Description     string            `json:"description"`
+		Readme          string            `json:"readme"`
+		Dependencies    map[string]string `json:"dependencies"`
+		Scripts         map[string]string `json:"scripts"`
+		Maintainers     []map[string]string
+		Engines         map[string]string `json:"engines"`
+		Dist            map[string]any    `json:"dist"`
+		GitHead         string            `json:"gitHead"`
+		NodeVersion     string            `json:"_nodeVersion"`
+		NpmUser         map[string]string `json:"_npmUser"`
+		HasShrinkwrap   bool              `json:"_hasShrinkwrap"`
+		DevDependencies map[string]string `json:"devDependencies"`
+		Deprecated      string            `json:"deprecated,omitempty"`
+	}
+
+	doc := map[string]any{
+		"_id":       "npm",
+		"name":      "npm",
+		"dist-tags": map[string]string{"latest": fmt.Sprintf("10.%d.0", versions-1), "next-10": fmt.Sprintf("10.%d.0", versions-1)},
+		"readme":    strings.Repeat("npm is the package manager for JavaScript. ", 2000),
+	}
+	manifests := map[string]manifest{}
+	times := map[string]string{}
+	for i := range versions {
+		version := fmt.Sprintf("10.%d.0", i)
+		deps := map[string]string{}
+		for d := range 60 {
+			deps[fmt.Sprintf("dependency-%d", d)] = fmt.Sprintf("^%d.%d.0", d%7, i%10)
+		}
+		var deprecated string
+		if i%10 == 0 {
+			deprecated = "This version has a critical bug, please upgrade"
+		}
+		manifests[version] = manifest{
+			Deprecated:   deprecated,
+			Name:         "npm",
+			Version:      version,
+			Description:  "a package manager for JavaScript",
+			Readme:       strings.Repeat("Usage notes. ", 100),
+			Dependencies: deps,
+			Scripts:      map[string]string{"test": "tap", "lint": "eslint .", "prepare": "node scripts/prepare.js"},
+			Maintainers:  []map[string]string{{"name": "npm-cli-ops", "email": "npm-cli+bot@github.com"}},
+			Engines:      map[string]string{"node": "^18.17.0 || >=20.5.0"},
+			Dist: map[string]any{
+				"integrity":    fmt.Sprintf("sha512-%064d==", i),
+				"shasum":       fmt.Sprintf("%040d", i),
+				"tarball":      fmt.Sprintf("https://registry.npmjs.org/npm/-/npm-%s.tgz", version),
+				"fileCount":    2500,
+				"unpackedSize": 11000000,
+				"signatures":   []map[string]string{{"keyid": "SHA256:jl3bwswu80PjjokCgh0o2w5c2U4LhQAE57gj9cz1kzA", "sig": strings.Repeat("A", 96)}},
+			},
+			GitHead:         strings.Repeat("f", 40),
+			NodeVersion:     "20.11.0",
+			NpmUser:         map[string]string{"name": "npm-cli-ops", "email": "npm-cli+bot@github.com"},
+			DevDependencies: deps,
+		}
+		times[version] = time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC).Format("2006-01-02T15:04:05.000Z")
+	}
+	doc["versions"] = manifests
+	doc["time"] = times
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// recordedPackument is the full yarn packument as registry.npmjs.org served
+// it in September 2025.
+func recordedPackument(tb testing.TB) []byte {
+	tb.Helper()
+	f, err := os.Open("testdata/yarn-packument.json.gz")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+func TestParsePackument(t *testing.T) {
+	data := fixturePackument(t, 50)
+
+	got, err := parsePackument(data)
+	if err != nil {
+		t.Fatalf("parsePackument() error = %v", err)
+	}
+
+	var want Packument
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &want) {
+		t.Error("parsePackument() differs from encoding/json")
+	}
+	if got.Versions["10.10.0"].Deprecated == "" || !got.Time["10.3.0"].Equal(time.Date(2024, 1, 1, 0, 0, 3, 0, time.UTC)) {
+		t.Errorf("expected deprecation and publish time, got %+v, %v", got.Versions["10.10.0"], got.Time["10.3.0"])
+	}
+	if got.Versions["10.3.0"].Engines["node"] != "^18.17.0 || >=20.5.0" {
+		t.Errorf("unexpected engines %v", got.Versions["10.3.0"].Engines)
+	}
+	if got.Versions["10.3.0"].Dist.Tarball != "https://registry.npmjs.org/npm/-/npm-10.3.0.tgz" {
+		t.Errorf("unexpected dist %+v", got.Versions["10.3.0"].Dist)
+	}
+}
+
+func TestParsePackument_Recorded(t *testing.T) {
+	data := recordedPackument(t)
+
+	got, err := parsePackument(data)
+	if err != nil {
+		t.Fatalf("parsePackument() error = %v", err)
+	}
+
+	var want Packument
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &want) {
+		t.Error("parsePackument() differs from encoding/json")
+	}
+	if got.DistTags["latest"] != "1.22.22" || got.Versions["1.22.22"].Dist.Integrity == "" {
+		t.Errorf("unexpected latest %s, dist %+v", got.DistTags["latest"], got.Versions["1.22.22"].Dist)
+	}
+}
+
+func TestParsePackument_Invalid(t *testing.T) {
+	for _, input := range []string{``, `{"dist-tags": {`, `[]`, `"npm"`} {
+		if _, err := parsePackument([]byte(input)); err == nil {
+			t.Errorf("parsePackument(%q) expected error", input)
+		}
+	}
+}
+
+func BenchmarkParsePackument(b *testing.B) {
+	data := recordedPackument(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := parsePackument(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodePackument is the encoding/json baseline parsePackument
+// replaced. Compare with:
+//
+//	go test -run '^$' -bench Packument ./internal/registry
+func BenchmarkDecodePackument(b *testing.B) {
+	data := recordedPackument(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for b.Loop() {
+		var packument Packument
+		if err := json.Unmarshal(data, &packument); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
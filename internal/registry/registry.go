@@ -1,52 +1,244 @@
 package registry
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ehyland/pmm2/internal/config"
 	"github.com/ehyland/pmm2/internal/inspector"
 )
 
+// Yarn 2+ ("Berry") is not published under the yarn package, which only
+// carries Yarn Classic 1.x releases.
+const BerryPackage = "@yarnpkg/cli-dist"
+
 type Packument struct {
-	DistTags map[string]string `json:"dist-tags"`
+	DistTags map[string]string           `json:"dist-tags"`
+	Versions map[string]PackumentVersion `json:"versions"`
+	// Time maps versions to their publish time. Only the full packument
+	// has it.
+	Time map[string]time.Time `json:"time,omitempty"`
+}
+
+type PackumentVersion struct {
+	Dist Dist `json:"dist"`
+	// Deprecated is the deprecation message, if the version is deprecated.
+	Deprecated string `json:"deprecated,omitempty"`
+	// Engines holds the version's runtime requirements, e.g. "node".
+	Engines map[string]string `json:"engines,omitempty"`
+}
+
+// Dist carries the digests the registry publishes for a version's tarball.
+// Integrity is a Subresource Integrity string ("sha512-<base64>"), Shasum a
+// hex sha1 kept for older packages.
+type Dist struct {
+	Integrity string `json:"integrity"`
+	Shasum    string `json:"shasum"`
+	Tarball   string `json:"tarball"`
+}
+
+// IsBerry reports whether spec refers to Yarn 2 or later.
+func IsBerry(spec inspector.PackageManagerSpec) bool {
+	if spec.Name != "yarn" {
+		return false
+	}
+	major, err := strconv.Atoi(strings.SplitN(spec.Version, ".", 2)[0])
+	return err == nil && major >= 2
+}
+
+// PackageName returns the npm package that the given spec is published as.
+func PackageName(spec inspector.PackageManagerSpec) string {
+	if IsBerry(spec) {
+		return BerryPackage
+	}
+	return spec.Name
 }
 
 func GetLatestVersion(conf *config.Config, name string) (*inspector.PackageManagerSpec, error) {
-	url := fmt.Sprintf("%s/%s", conf.Registry, name)
-	resp, err := http.Get(url)
+	return getLatestVersion(conf, name, name)
+}
+
+// GetLatestBerryVersion returns the latest Yarn 2+ release. GetLatestVersion
+// keeps resolving yarn to Yarn Classic.
+func GetLatestBerryVersion(conf *config.Config) (*inspector.PackageManagerSpec, error) {
+	return getLatestVersion(conf, "yarn", BerryPackage)
+}
+
+func getLatestVersion(conf *config.Config, name, pkgName string) (*inspector.PackageManagerSpec, error) {
+	packument, err := GetPackument(conf, pkgName)
 	if err != nil {
+		return nil, err
+	}
+
+	version, ok := packument.DistTags["latest"]
+	if !ok {
+		return nil, fmt.Errorf("latest dist-tag not found for %s", pkgName)
+	}
+
+	return &inspector.PackageManagerSpec{
+		Name:    name,
+		Version: version,
+	}, nil
+}
+
+// GetPackument returns pkgName's abbreviated metadata. Responses are cached
+// under PmmDir: within conf.MetadataTTL the cache is used as-is, after that
+// it is revalidated with ETag/Last-Modified. Offline, the cache is all there
+// is.
+func GetPackument(conf *config.Config, pkgName string) (*Packument, error) {
+	return getPackument(conf, pkgName, abbreviatedFormat, false)
+}
+
+// GetFullPackument is GetPackument for the full document, which adds
+// release times.
+func GetFullPackument(conf *config.Config, pkgName string) (*Packument, error) {
+	return getPackument(conf, pkgName, fullFormat, false)
+}
+
+// RevalidatePackument is GetPackument without conf.MetadataTTL: a cached
+// packument is always revalidated. It is for when a cached copy lacks the
+// version or dist-tag being looked for, which may just have been published.
+func RevalidatePackument(conf *config.Config, pkgName string) (*Packument, error) {
+	return getPackument(conf, pkgName, abbreviatedFormat, true)
+}
+
+// RevalidateFullPackument is RevalidatePackument for the full document.
+func RevalidateFullPackument(conf *config.Config, pkgName string) (*Packument, error) {
+	return getPackument(conf, pkgName, fullFormat, true)
+}
+
+func getPackument(conf *config.Config, pkgName string, format packumentFormat, revalidate bool) (*Packument, error) {
+	registries := registriesFor(conf, pkgName)
+	cached := map[string]*cachedPackument{}
+	for _, registry := range registries {
+		cached[registry] = readPackumentCache(conf, registry, pkgName, format)
+	}
+	primary := cached[registries[0]]
+	if IsOffline(conf) {
+		return decodeCachedPackument(pkgName, anyCached(registries, cached))
+	}
+	if primary != nil && !revalidate && primary.fresh(conf.MetadataTTL) {
+		return decodeCachedPackument(pkgName, primary)
+	}
+
+	// Each registry is revalidated against its own copy.
+	var urls []string
+	registryOf := map[string]string{}
+	for _, registry := range registries {
+		u := fmt.Sprintf("%s/%s", registry, escapePackageName(pkgName))
+		urls = append(urls, u)
+		registryOf[u] = registry
+	}
+	var answered string
+	resp, err := getFirst(urls, func(u string) (*http.Response, error) {
+		answered = registryOf[u]
+		header := http.Header{"Accept": {format.accept}}
+		if c := cached[answered]; c != nil {
+			if c.ETag != "" {
+				header.Set("If-None-Match", c.ETag)
+			}
+			if c.LastModified != "" {
+				header.Set("If-Modified-Since", c.LastModified)
+			}
+		}
+		return registryGet(conf, u, header)
+	})
+	if err != nil {
+		if err := fallBackOffline(conf, err); errors.Is(err, ErrOffline) {
+			return decodeCachedPackument(pkgName, anyCached(registries, cached))
+		}
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if c := cached[answered]; resp.StatusCode == http.StatusNotModified && c != nil {
+		c.FetchedAt = time.Now().UTC()
+		writePackumentCache(conf, answered, pkgName, format, c)
+		return decodeCachedPackument(pkgName, c)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	var packument Packument
-	if err := json.NewDecoder(resp.Body).Decode(&packument); err != nil {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	packument, err := parsePackument(data)
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	writePackumentCache(conf, answered, pkgName, format, &cachedPackument{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+		Packument:    data,
+	})
 
-	version, ok := packument.DistTags["latest"]
+	return packument, nil
+}
+
+// anyCached returns the first registry's cached copy there is, for when
+// none can be reached.
+func anyCached(registries []string, cached map[string]*cachedPackument) *cachedPackument {
+	for _, registry := range registries {
+		if c := cached[registry]; c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+func decodeCachedPackument(pkgName string, cached *cachedPackument) (*Packument, error) {
+	if cached == nil {
+		return nil, fmt.Errorf("%w: no cached metadata for %s", ErrOffline, pkgName)
+	}
+	packument, err := parsePackument(cached.Packument)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cached metadata for %s: %w", pkgName, err)
+	}
+	return packument, nil
+}
+
+// GetDist returns the published digests for spec's tarball.
+func GetDist(conf *config.Config, spec inspector.PackageManagerSpec) (*Dist, error) {
+	pkgName := PackageName(spec)
+	packument, err := GetPackument(conf, pkgName)
+	if err != nil {
+		return nil, err
+	}
+
+	version, ok := packument.Versions[spec.Version]
 	if !ok {
-		return nil, fmt.Errorf("latest dist-tag not found for %s", name)
+		if packument, err = RevalidatePackument(conf, pkgName); err != nil {
+			return nil, err
+		}
+		version, ok = packument.Versions[spec.Version]
+	}
+	if !ok {
+		return nil, fmt.Errorf("version %s not found for %s", spec.Version, pkgName)
 	}
 
-	return &inspector.PackageManagerSpec{
-		Name:    name,
-		Version: version,
-	}, nil
+	return &version.Dist, nil
 }
 
 func DownloadTarball(conf *config.Config, spec inspector.PackageManagerSpec) (io.ReadCloser, error) {
-	url := fmt.Sprintf("%s/%s/-/%s-%s.tgz", conf.Registry, spec.Name, spec.Name, spec.Version)
-	resp, err := http.Get(url)
+	pkgName := PackageName(spec)
+	if err := offlineError(conf, pkgName+"@"+spec.Version); err != nil {
+		return nil, err
+	}
+	resp, err := registryGetFirst(conf, pkgName, nil, func(registry string) string {
+		return tarballURL(registry, pkgName, spec.Version)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("http request failed: %w", err)
+		return nil, fmt.Errorf("http request failed: %w", fallBackOffline(conf, err))
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -57,6 +249,86 @@ func DownloadTarball(conf *config.Config, spec inspector.PackageManagerSpec) (io
 	return resp.Body, nil
 }
 
+// registriesFor returns the registries that serve pkgName in failover
+// order. A @scope:registry= override from .npmrc replaces the list.
+func registriesFor(conf *config.Config, pkgName string) []string {
+	if scoped := conf.NpmRC.ScopeRegistry(pkgName); scoped != "" {
+		return []string{strings.TrimSuffix(scoped, "/")}
+	}
+	return append([]string{conf.Registry}, conf.FallbackRegistries...)
+}
+
+// registryGetFirst requests urlFor(registry) from each registry serving
+// pkgName until one answers.
+func registryGetFirst(conf *config.Config, pkgName string, header http.Header, urlFor func(registry string) string) (*http.Response, error) {
+	var urls []string
+	for _, registry := range registriesFor(conf, pkgName) {
+		urls = append(urls, urlFor(registry))
+	}
+	return getFirst(urls, func(url string) (*http.Response, error) {
+		return registryGet(conf, url, header)
+	})
+}
+
+// getFirst tries each url in order, moving on when a request fails or the
+// server answers with a retryable status. The last response is returned
+// as-is so callers report its status.
+func getFirst(urls []string, fetch func(url string) (*http.Response, error)) (*http.Response, error) {
+	var lastErr error
+	for i, url := range urls {
+		resp, err := fetch(url)
+		if err == nil && (i == len(urls)-1 || !shouldRetry(resp, nil)) {
+			return resp, nil
+		}
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+			resp.Body.Close()
+		}
+		if i < len(urls)-1 {
+			fmt.Fprintf(os.Stderr, "⚠️  %s failed (%v), trying %s\n", hostOf(url), lastErr, hostOf(urls[i+1]))
+		}
+	}
+	return nil, lastErr
+}
+
+func hostOf(rawURL string) string {
+	if u, err := neturl.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// registryGet fetches url with any .npmrc credentials that apply to it. The
+// credentials are only ever placed in the request header.
+func registryGet(conf *config.Config, url string, header http.Header) (*http.Response, error) {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if auth := conf.NpmRC.AuthHeader(url, conf.Registry); auth != "" {
+		header.Set("Authorization", auth)
+	}
+	return get(conf, url, header)
+}
+
+// tarballURL follows the registry layout, where scoped packages drop the
+// scope from the tarball file name: @scope/name/-/name-1.0.0.tgz.
+func tarballURL(registry, pkgName, version string) string {
+	base := pkgName
+	if idx := strings.LastIndex(pkgName, "/"); idx != -1 {
+		base = pkgName[idx+1:]
+	}
+	return fmt.Sprintf("%s/%s/-/%s-%s.tgz", registry, pkgName, base, version)
+}
+
+// escapePackageName encodes the scope separator, which some registries
+// require for packument requests.
+func escapePackageName(pkgName string) string {
+	return strings.Replace(pkgName, "/", "%2f", 1)
+}
+
 func DownloadBunZip(conf *config.Config, spec inspector.PackageManagerSpec, osName, arch string) (io.ReadCloser, error) {
 	if arch == "amd64" {
 		arch = "x64"
@@ -64,10 +336,23 @@ func DownloadBunZip(conf *config.Config, spec inspector.PackageManagerSpec, osNa
 		arch = "aarch64"
 	}
 
-	url := fmt.Sprintf("https://github.com/oven-sh/bun/releases/download/bun-v%s/bun-%s-%s.zip", spec.Version, osName, arch)
-	resp, err := http.Get(url)
+	if err := offlineError(conf, "bun@"+spec.Version); err != nil {
+		return nil, err
+	}
+
+	bases := conf.BunDownloadURLs
+	if len(bases) == 0 {
+		bases = []string{config.DefaultBunDownloadURL}
+	}
+	var urls []string
+	for _, base := range bases {
+		urls = append(urls, fmt.Sprintf("%s/bun-v%s/bun-%s-%s.zip", base, spec.Version, osName, arch))
+	}
+	resp, err := getFirst(urls, func(url string) (*http.Response, error) {
+		return get(conf, url, nil)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("http request failed: %w", err)
+		return nil, fmt.Errorf("http request failed: %w", fallBackOffline(conf, err))
 	}
 
 	if resp.StatusCode != http.StatusOK {
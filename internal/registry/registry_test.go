@@ -2,14 +2,17 @@ package registry
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/ehyland/pmm2/internal/config"
 	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/npmrc"
 )
 
 func TestGetLatestVersion(t *testing.T) {
@@ -62,3 +65,243 @@ func TestDownloadTarball(t *testing.T) {
 		t.Errorf("expected mock tarball content, got %s", string(content))
 	}
 }
+
+func TestDownloadTarball_Berry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expectedPath := "/@yarnpkg/cli-dist/-/cli-dist-4.1.0.tgz"
+		if r.URL.Path != expectedPath {
+			t.Errorf("expected request path %s, got %s", expectedPath, r.URL.Path)
+		}
+		fmt.Fprint(w, "mock tarball content")
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL}
+	spec := inspector.PackageManagerSpec{Name: "yarn", Version: "4.1.0"}
+	body, err := DownloadTarball(conf, spec)
+	if err != nil {
+		t.Fatalf("DownloadTarball() error = %v", err)
+	}
+	body.Close()
+}
+
+func TestGetLatestBerryVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/@yarnpkg%2fcli-dist" {
+			t.Errorf("expected request path /@yarnpkg%%2fcli-dist, got %s", r.URL.EscapedPath())
+		}
+		json.NewEncoder(w).Encode(Packument{DistTags: map[string]string{"latest": "4.1.0"}})
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL}
+	spec, err := GetLatestBerryVersion(conf)
+	if err != nil {
+		t.Fatalf("GetLatestBerryVersion() error = %v", err)
+	}
+	if spec.Name != "yarn" || spec.Version != "4.1.0" {
+		t.Errorf("expected yarn@4.1.0, got %s@%s", spec.Name, spec.Version)
+	}
+}
+
+func TestIsBerry(t *testing.T) {
+	tests := []struct {
+		spec     inspector.PackageManagerSpec
+		expected bool
+	}{
+		{inspector.PackageManagerSpec{Name: "yarn", Version: "1.22.22"}, false},
+		{inspector.PackageManagerSpec{Name: "yarn", Version: "2.4.3"}, true},
+		{inspector.PackageManagerSpec{Name: "yarn", Version: "4.1.0"}, true},
+		{inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsBerry(tt.spec); got != tt.expected {
+			t.Errorf("IsBerry(%v) = %v; want %v", tt.spec, got, tt.expected)
+		}
+	}
+}
+
+func TestGetDist(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"versions": {"8.0.0": {"dist": {"integrity": "sha512-abc", "shasum": "def"}}}}`)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL}
+	dist, err := GetDist(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "8.0.0"})
+	if err != nil {
+		t.Fatalf("GetDist() error = %v", err)
+	}
+	if dist.Integrity != "sha512-abc" || dist.Shasum != "def" {
+		t.Errorf("unexpected dist %+v", dist)
+	}
+
+	if _, err := GetDist(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.9.9"}); err == nil {
+		t.Error("expected error for unknown version, got nil")
+	}
+}
+
+func TestGetPackument_NpmrcAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"dist-tags": {"latest": "9.0.0"}}`)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http:")
+	conf := &config.Config{
+		Registry: server.URL,
+		NpmRC:    npmrc.Parse([]byte(host + "/:_authToken=s3cr3t")),
+	}
+	spec, err := GetLatestVersion(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("GetLatestVersion() error = %v", err)
+	}
+	if spec.Version != "9.0.0" {
+		t.Errorf("expected 9.0.0, got %s", spec.Version)
+	}
+
+	conf.NpmRC = nil
+	_, err = GetLatestVersion(conf, "pnpm")
+	if err == nil {
+		t.Fatal("expected error without credentials, got nil")
+	}
+	if strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("error leaked the token: %v", err)
+	}
+}
+
+func TestGetPackument_ScopeRegistry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"dist-tags": {"latest": "4.1.0"}}`)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{
+		Registry: "http://127.0.0.1:0",
+		NpmRC:    npmrc.Parse([]byte("@yarnpkg:registry=" + server.URL + "/")),
+	}
+	spec, err := GetLatestBerryVersion(conf)
+	if err != nil {
+		t.Fatalf("GetLatestBerryVersion() error = %v", err)
+	}
+	if spec.Version != "4.1.0" {
+		t.Errorf("expected 4.1.0, got %s", spec.Version)
+	}
+}
+
+func TestGetPackument_FallbackRegistries(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(packumentHandler))
+	defer mirror.Close()
+
+	conf := &config.Config{Registry: down.URL, FallbackRegistries: []string{closed.URL, mirror.URL}}
+	spec, err := GetLatestVersion(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("GetLatestVersion() error = %v", err)
+	}
+	if spec.Version != "9.0.0" {
+		t.Errorf("expected 9.0.0, got %s", spec.Version)
+	}
+}
+
+func TestGetPackument_FallbackNotUsedForNotFound(t *testing.T) {
+	primary := httptest.NewServer(http.NotFoundHandler())
+	defer primary.Close()
+	var mirrorCalls int
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorCalls++
+		packumentHandler(w, r)
+	}))
+	defer mirror.Close()
+
+	conf := &config.Config{Registry: primary.URL, FallbackRegistries: []string{mirror.URL}}
+	if _, err := GetLatestVersion(conf, "pnpm"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+	if mirrorCalls != 0 {
+		t.Errorf("expected no fallback for 404, mirror saw %d requests", mirrorCalls)
+	}
+}
+
+func TestDownloadBunZip_Mirrors(t *testing.T) {
+	var path string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, "zip")
+	}))
+	defer mirror.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	conf := &config.Config{BunDownloadURLs: []string{closed.URL, mirror.URL + "/bun"}}
+	body, err := DownloadBunZip(conf, inspector.PackageManagerSpec{Name: "bun", Version: "1.1.0"}, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("DownloadBunZip() error = %v", err)
+	}
+	defer body.Close()
+
+	if path != "/bun/bun-v1.1.0/bun-linux-x64.zip" {
+		t.Errorf("unexpected download path %s", path)
+	}
+}
+
+func TestGetPackument_Offline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(packumentHandler))
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+	if _, err := GetPackument(conf, "pnpm"); err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	server.Close()
+
+	offline := &config.Config{Registry: server.URL, PmmDir: conf.PmmDir, Offline: true}
+	packument, err := GetPackument(offline, "pnpm")
+	if err != nil {
+		t.Fatalf("GetPackument() offline error = %v", err)
+	}
+	if packument.DistTags["latest"] != "9.0.0" {
+		t.Errorf("expected cached latest 9.0.0, got %s", packument.DistTags["latest"])
+	}
+
+	if _, err := GetPackument(offline, "npm"); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected ErrOffline for uncached packument, got %v", err)
+	}
+	if _, err := DownloadTarball(offline, inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0"}); !errors.Is(err, ErrOffline) {
+		t.Errorf("expected ErrOffline for download, got %v", err)
+	}
+}
+
+func TestGetPackument_OfflineFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(packumentHandler))
+	pmmDir := t.TempDir()
+	if _, err := GetPackument(&config.Config{Registry: server.URL, PmmDir: pmmDir}, "pnpm"); err != nil {
+		t.Fatalf("GetPackument() error = %v", err)
+	}
+	server.Close()
+
+	conf := &config.Config{Registry: server.URL, PmmDir: pmmDir, OfflineFallback: true}
+	packument, err := GetPackument(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("GetPackument() with fallback error = %v", err)
+	}
+	if packument.DistTags["latest"] != "9.0.0" {
+		t.Errorf("expected cached latest 9.0.0, got %s", packument.DistTags["latest"])
+	}
+	if !IsOffline(conf) {
+		t.Error("expected network failure to switch to offline mode")
+	}
+
+	strict := &config.Config{Registry: server.URL, PmmDir: pmmDir}
+	if _, err := GetPackument(strict, "pnpm"); err == nil || errors.Is(err, ErrOffline) {
+		t.Errorf("expected network error without fallback, got %v", err)
+	}
+}
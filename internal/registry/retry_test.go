@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+)
+
+func init() {
+	retryBaseDelay = time.Millisecond
+}
+
+// flakyServer fails the first `failures` requests with status, then serves
+// a packument.
+func flakyServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(status)
+			return
+		}
+		packumentHandler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestGet_RetriesServerErrors(t *testing.T) {
+	server, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+
+	conf := &config.Config{Registry: server.URL, HTTPRetries: 3}
+	spec, err := GetLatestVersion(conf, "pnpm")
+	if err != nil {
+		t.Fatalf("GetLatestVersion() error = %v", err)
+	}
+	if spec.Version != "9.0.0" {
+		t.Errorf("GetLatestVersion() = %q, want 9.0.0", spec.Version)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+}
+
+func TestGet_HonorsRetryAfter(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+
+	conf := &config.Config{Registry: server.URL, HTTPRetries: 1}
+	if _, err := GetLatestVersion(conf, "pnpm"); err != nil {
+		t.Fatalf("GetLatestVersion() error = %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+}
+
+func TestGet_DoesNotRetryClientErrors(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusNotFound, nil)
+
+	conf := &config.Config{Registry: server.URL, HTTPRetries: 3}
+	if _, err := GetLatestVersion(conf, "pnpm"); err == nil {
+		t.Fatal("expected error for 404")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+}
+
+func TestGet_RetriesExhausted(t *testing.T) {
+	server, calls := flakyServer(t, 10, http.StatusBadGateway, nil)
+
+	conf := &config.Config{Registry: server.URL, HTTPRetries: 2}
+	if _, err := GetLatestVersion(conf, "pnpm"); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("expected 502 error, got %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+}
+
+func TestGet_RetriesConnectionReset(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		packumentHandler(w, r)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL, HTTPRetries: 1}
+	if _, err := GetLatestVersion(conf, "pnpm"); err != nil {
+		t.Fatalf("GetLatestVersion() error = %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+}
+
+func TestGet_UserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		packumentHandler(w, r)
+	}))
+	defer server.Close()
+
+	conf := &config.Config{Registry: server.URL, UserAgent: "pmm2/1.2.3"}
+	if _, err := GetLatestVersion(conf, "pnpm"); err != nil {
+		t.Fatalf("GetLatestVersion() error = %v", err)
+	}
+	if userAgent != "pmm2/1.2.3" {
+		t.Errorf("User-Agent = %q, want pmm2/1.2.3", userAgent)
+	}
+}
+
+func TestGet_ReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"dist-tags":`)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	conf := &config.Config{Registry: server.URL, ReadTimeout: 50 * time.Millisecond}
+	resp, err := get(conf, server.URL, nil)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(resp.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "no data received") {
+			t.Errorf("expected read timeout error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled body was not timed out")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"2", 2 * time.Second, true},
+		{"3600", maxRetryDelay, true},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {tt.value}}}
+		got, ok := retryAfter(resp)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/humanize"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+// Latest returns the version that name's latest dist-tag points to. With
+// conf.MinReleaseAge set, it is the newest release up to latest that has
+// been public for that long.
+func Latest(conf *config.Config, name string) (*inspector.PackageManagerSpec, error) {
+	if conf.MinReleaseAge <= 0 {
+		return registry.GetLatestVersion(conf, name)
+	}
+	return resolveMature(conf, inspector.PackageManagerSpec{Name: name, Version: "latest"})
+}
+
+// ResolveMature is Resolve for adopting a new version. With
+// conf.MinReleaseAge set, ranges and dist-tags resolve to the newest
+// matching release that has been public for that long, and younger exact
+// versions are refused. Offline it is plain Resolve, which only picks
+// versions that were adopted already.
+func ResolveMature(conf *config.Config, spec inspector.PackageManagerSpec) (*inspector.PackageManagerSpec, error) {
+	if conf.MinReleaseAge <= 0 || registry.IsOffline(conf) {
+		return Resolve(conf, spec)
+	}
+	return resolveMature(conf, spec)
+}
+
+func resolveMature(conf *config.Config, spec inspector.PackageManagerSpec) (*inspector.PackageManagerSpec, error) {
+	packuments, err := GetFullPackuments(conf, spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	if lacks(spec, packuments) {
+		if packuments, err = fetchPackuments(conf, spec.Name, registry.RevalidateFullPackument); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+
+	if IsExact(spec.Version) {
+		for _, packument := range packuments {
+			if _, ok := packument.Versions[spec.Version]; !ok {
+				continue
+			}
+			if reason := tooNew(conf, packument, spec.Version, now); reason != "" {
+				return nil, fmt.Errorf("%s@%s was %s", spec.Name, spec.Version, reason)
+			}
+			return &spec, nil
+		}
+		return nil, fmt.Errorf("%s@%s is not published", spec.Name, spec.Version)
+	}
+
+	// A dist-tag is a ceiling: step back from the tagged release within the
+	// same package, so yarn@stable never falls back to Yarn Classic.
+	searched := packuments
+	var match func(*semver.Version) bool
+	if tagged, ok := lookupDistTag(spec.Name, spec.Version, packuments); ok {
+		ceiling, err := semver.NewVersion(tagged)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %s for %s@%s: %w", tagged, spec.Name, spec.Version, err)
+		}
+		for _, packument := range packuments {
+			if _, ok := packument.Versions[tagged]; ok {
+				searched = []*registry.Packument{packument}
+				break
+			}
+		}
+		match = func(v *semver.Version) bool {
+			return !v.GreaterThan(ceiling) && (v.Prerelease() == "" || ceiling.Prerelease() != "")
+		}
+	} else {
+		constraint, err := semver.NewConstraint(spec.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s is neither a dist-tag nor a valid version range for %s", spec.Version, spec.Name)
+		}
+		match = constraint.Check
+	}
+
+	var best *semver.Version
+	for _, packument := range searched {
+		for v := range packument.Versions {
+			version, err := semver.NewVersion(v)
+			if err != nil || !match(version) || tooNew(conf, packument, v, now) != "" {
+				continue
+			}
+			if best == nil || version.GreaterThan(best) {
+				best = version
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no release of %s matching %s is older than the minimum release age of %s", spec.Name, spec.Version, humanize.Duration(conf.MinReleaseAge))
+	}
+
+	fmt.Fprintf(os.Stderr, "Resolved %s@%s to %s@%s (minimum release age %s)\n", spec.Name, spec.Version, spec.Name, best.Original(), humanize.Duration(conf.MinReleaseAge))
+	return &inspector.PackageManagerSpec{Name: spec.Name, Version: best.Original()}, nil
+}
+
+// tooNew explains why version can't be adopted yet, or returns "" if it has
+// been public for conf.MinReleaseAge. A release without a publish time is
+// treated as new.
+func tooNew(conf *config.Config, packument *registry.Packument, version string, now time.Time) string {
+	published, ok := packument.Time[version]
+	if !ok {
+		return "published at an unknown time"
+	}
+	if age := now.Sub(published); age < conf.MinReleaseAge {
+		return fmt.Sprintf("published %s ago, under the minimum release age of %s", humanize.Duration(age), humanize.Duration(conf.MinReleaseAge))
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+func newCooldownServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	daysAgo := func(days int) time.Time { return time.Now().Add(-time.Duration(days) * 24 * time.Hour) }
+	withTimes := func(p registry.Packument, times map[string]time.Time) registry.Packument {
+		p.Time = times
+		return p
+	}
+	full := map[string]registry.Packument{
+		"/pnpm": withTimes(packuments["/pnpm"], map[string]time.Time{
+			"8.15.8": daysAgo(200), "8.15.9": daysAgo(100), "9.0.0": daysAgo(30),
+			"9.12.0": daysAgo(2), "10.0.0-rc.1": daysAgo(1),
+		}),
+		"/yarn": withTimes(packuments["/yarn"], map[string]time.Time{
+			"1.22.19": daysAgo(900), "1.22.22": daysAgo(300),
+		}),
+		"/@yarnpkg/cli-dist": withTimes(packuments["/@yarnpkg/cli-dist"], map[string]time.Time{
+			"3.8.7": daysAgo(60), "4.5.0": daysAgo(3), "4.6.0-rc.1": daysAgo(1),
+		}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := full[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(p)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolveMature(t *testing.T) {
+	server := newCooldownServer(t)
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), MinReleaseAge: 7 * 24 * time.Hour}
+
+	tests := []struct {
+		name     string
+		version  string
+		expected string
+		wantErr  bool
+	}{
+		{"pnpm", "latest", "9.0.0", false},
+		{"pnpm", "^9", "9.0.0", false},
+		{"pnpm", "^8", "8.15.9", false},
+		{"pnpm", "next-10", "9.0.0", false},
+		{"pnpm", "8.15.8", "8.15.8", false},
+		{"pnpm", "9.12.0", "", true},
+		{"pnpm", "7.0.0", "", true},
+		{"pnpm", ">=9.1", "", true},
+		{"yarn", "stable", "3.8.7", false},
+		{"yarn", "latest", "1.22.22", false},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveMature(conf, inspector.PackageManagerSpec{Name: tt.name, Version: tt.version})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveMature(%s@%s) error = %v, wantErr %v", tt.name, tt.version, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got.Version != tt.expected {
+			t.Errorf("ResolveMature(%s@%s) = %s, want %s", tt.name, tt.version, got.Version, tt.expected)
+		}
+	}
+
+	latest, err := Latest(conf, "pnpm")
+	if err != nil || latest.Version != "9.0.0" {
+		t.Errorf("Latest(pnpm) = %v, %v, want 9.0.0", latest, err)
+	}
+}
+
+func TestFindUpdate_MinReleaseAge(t *testing.T) {
+	server := newCooldownServer(t)
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), MinReleaseAge: 7 * 24 * time.Hour}
+
+	target, skipped, err := FindUpdate(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "8.15.8"}, WithinMajor, nil)
+	if err != nil {
+		t.Fatalf("FindUpdate() error = %v", err)
+	}
+	if target == nil || target.Version != "9.0.0" {
+		t.Errorf("expected 9.0.0, got %v", target)
+	}
+	if len(skipped) != 1 || skipped[0].Version != "9.12.0" {
+		t.Errorf("expected 9.12.0 to be skipped, got %v", skipped)
+	}
+}
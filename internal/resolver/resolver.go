@@ -0,0 +1,248 @@
+package resolver
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+// IsExact reports whether version names a single release, as opposed to a
+// semver range ("^9", "9.x") or a dist-tag ("latest", "next").
+func IsExact(version string) bool {
+	_, err := semver.StrictNewVersion(version)
+	return err == nil
+}
+
+// Satisfies reports whether version is within the semver range rng.
+func Satisfies(version, rng string) (bool, error) {
+	constraint, err := semver.NewConstraint(rng)
+	if err != nil {
+		return false, fmt.Errorf("invalid version range %s: %w", rng, err)
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, fmt.Errorf("invalid version %s: %w", version, err)
+	}
+	return constraint.Check(v), nil
+}
+
+// Resolve turns the range or dist-tag in spec into a concrete version. Exact
+// versions are returned as-is without touching the network. Resolutions are
+// cached under PmmDir for conf.ResolveTTL.
+func Resolve(conf *config.Config, spec inspector.PackageManagerSpec) (*inspector.PackageManagerSpec, error) {
+	if IsExact(spec.Version) {
+		return &spec, nil
+	}
+
+	if !registry.IsOffline(conf) {
+		cachePath := getCachePath(conf, spec)
+		if version, ok := readCache(cachePath, conf.ResolveTTL); ok {
+			return &inspector.PackageManagerSpec{Name: spec.Name, Version: version}, nil
+		}
+
+		version, err := resolveFromRegistry(conf, spec)
+		if !registry.IsOffline(conf) {
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(os.Stderr, "Resolved %s@%s to %s@%s\n", spec.Name, spec.Version, spec.Name, version)
+			writeCache(cachePath, version)
+			return &inspector.PackageManagerSpec{Name: spec.Name, Version: version}, nil
+		}
+	}
+
+	version, err := resolveOffline(conf, spec)
+	if err != nil {
+		return nil, err
+	}
+	return &inspector.PackageManagerSpec{Name: spec.Name, Version: version}, nil
+}
+
+// resolveOffline only picks versions that are already installed. Dist-tags
+// are looked up in cached metadata.
+func resolveOffline(conf *config.Config, spec inspector.PackageManagerSpec) (string, error) {
+	installed, err := installer.ListInstalled(conf, spec.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if packuments, err := getPackuments(conf, spec.Name); err == nil {
+		if version, ok := lookupDistTag(spec.Name, spec.Version, packuments); ok {
+			if slices.Contains(installed, version) {
+				return version, nil
+			}
+			return "", &installer.OfflineError{Spec: spec, Available: installed}
+		}
+	}
+
+	constraint, err := semver.NewConstraint(spec.Version)
+	if err != nil {
+		return "", &installer.OfflineError{Spec: spec, Available: installed}
+	}
+	for i := len(installed) - 1; i >= 0; i-- {
+		if version, err := semver.NewVersion(installed[i]); err == nil && constraint.Check(version) {
+			return installed[i], nil
+		}
+	}
+	return "", &installer.OfflineError{Spec: spec, Available: installed}
+}
+
+func resolveFromRegistry(conf *config.Config, spec inspector.PackageManagerSpec) (string, error) {
+	packuments, err := getPackuments(conf, spec.Name)
+	if err != nil {
+		return "", err
+	}
+	if lacks(spec, packuments) {
+		if packuments, err = fetchPackuments(conf, spec.Name, registry.RevalidatePackument); err != nil {
+			return "", err
+		}
+	}
+
+	if version, ok := lookupDistTag(spec.Name, spec.Version, packuments); ok {
+		return version, nil
+	}
+
+	constraint, err := semver.NewConstraint(spec.Version)
+	if err != nil {
+		return "", fmt.Errorf("%s is neither a dist-tag nor a valid version range for %s", spec.Version, spec.Name)
+	}
+
+	var best *semver.Version
+	for _, packument := range packuments {
+		for v := range packument.Versions {
+			version, err := semver.NewVersion(v)
+			if err != nil || !constraint.Check(version) {
+				continue
+			}
+			if best == nil || version.GreaterThan(best) {
+				best = version
+			}
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no version of %s matches %s", spec.Name, spec.Version)
+	}
+
+	return best.Original(), nil
+}
+
+// getPackuments returns every packument that name's releases are spread
+// over. For yarn that is Yarn Classic followed by Yarn Berry.
+func getPackuments(conf *config.Config, name string) ([]*registry.Packument, error) {
+	return fetchPackuments(conf, name, registry.GetPackument)
+}
+
+// GetFullPackuments is getPackuments with full packuments, for callers that
+// need release times.
+func GetFullPackuments(conf *config.Config, name string) ([]*registry.Packument, error) {
+	return fetchPackuments(conf, name, registry.GetFullPackument)
+}
+
+func fetchPackuments(conf *config.Config, name string, fetch func(*config.Config, string) (*registry.Packument, error)) ([]*registry.Packument, error) {
+	pkgNames := []string{name}
+	if name == "yarn" {
+		pkgNames = append(pkgNames, registry.BerryPackage)
+	}
+
+	var packuments []*registry.Packument
+	for _, pkgName := range pkgNames {
+		packument, err := fetch(conf, pkgName)
+		if err != nil {
+			return nil, err
+		}
+		packuments = append(packuments, packument)
+	}
+	return packuments, nil
+}
+
+// lacks reports whether none of packuments has a release spec could
+// resolve to. A cached copy may predate a just-published version or
+// dist-tag, so it is then worth revalidating.
+func lacks(spec inspector.PackageManagerSpec, packuments []*registry.Packument) bool {
+	if _, ok := lookupDistTag(spec.Name, spec.Version, packuments); ok {
+		return false
+	}
+	constraint, err := semver.NewConstraint(spec.Version)
+	if err != nil {
+		return true
+	}
+	for _, packument := range packuments {
+		for v := range packument.Versions {
+			if version, err := semver.NewVersion(v); err == nil && constraint.Check(version) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookupDistTag finds tag in the packuments in order. Following corepack,
+// yarn@stable is the latest Yarn Berry release.
+func lookupDistTag(name, tag string, packuments []*registry.Packument) (string, bool) {
+	if name == "yarn" && tag == "stable" {
+		version, ok := packuments[len(packuments)-1].DistTags["latest"]
+		return version, ok
+	}
+	for _, packument := range packuments {
+		if version, ok := packument.DistTags[tag]; ok {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// DistTags returns every dist-tag of name and the version it resolves to,
+// following the same precedence as lookupDistTag.
+func DistTags(name string, packuments []*registry.Packument) map[string]string {
+	tags := map[string]string{}
+	for i := len(packuments) - 1; i >= 0; i-- {
+		maps.Copy(tags, packuments[i].DistTags)
+	}
+	if version, ok := lookupDistTag(name, "stable", packuments); ok && name == "yarn" {
+		tags["stable"] = version
+	}
+	return tags
+}
+
+// Cached returns the version spec last resolved to, if that is still within
+// conf.ResolveTTL. It never reaches the registry.
+func Cached(conf *config.Config, spec inspector.PackageManagerSpec) (string, bool) {
+	return readCache(getCachePath(conf, spec), conf.ResolveTTL)
+}
+
+func getCachePath(conf *config.Config, spec inspector.PackageManagerSpec) string {
+	key := url.PathEscape(fmt.Sprintf("%s@%s", spec.Name, spec.Version))
+	return filepath.Join(conf.PmmDir, "cache", "resolved", key)
+}
+
+func readCache(path string, ttl time.Duration) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	version := strings.TrimSpace(string(data))
+	return version, version != ""
+}
+
+// writeCache is best effort; a failed write only costs a lookup next time.
+func writeCache(path, version string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	os.WriteFile(path, []byte(version), 0644)
+}
@@ -0,0 +1,185 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+func packument(tags map[string]string, versions ...string) registry.Packument {
+	p := registry.Packument{DistTags: tags, Versions: map[string]registry.PackumentVersion{}}
+	for _, v := range versions {
+		p.Versions[v] = registry.PackumentVersion{}
+	}
+	return p
+}
+
+var packuments = map[string]registry.Packument{
+	"/pnpm": packument(
+		map[string]string{"latest": "9.12.0", "next-10": "10.0.0-rc.1"},
+		"8.15.8", "8.15.9", "9.0.0", "9.12.0", "10.0.0-rc.1",
+	),
+	"/yarn": packument(map[string]string{"latest": "1.22.22"}, "1.22.19", "1.22.22"),
+	"/@yarnpkg/cli-dist": packument(
+		map[string]string{"latest": "4.5.0", "canary": "4.6.0-rc.1"},
+		"3.8.7", "4.5.0", "4.6.0-rc.1",
+	),
+}
+
+func newRegistryServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		p, ok := packuments[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(p)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestResolve(t *testing.T) {
+	server, _ := newRegistryServer(t)
+
+	tests := []struct {
+		name     string
+		version  string
+		expected string
+		wantErr  bool
+	}{
+		{"pnpm", "^8", "8.15.9", false},
+		{"pnpm", "9.x", "9.12.0", false},
+		{"pnpm", ">=9", "9.12.0", false},
+		{"pnpm", "latest", "9.12.0", false},
+		{"pnpm", "next-10", "10.0.0-rc.1", false},
+		{"pnpm", "^7", "", true},
+		{"pnpm", "bogus", "", true},
+		{"yarn", "stable", "4.5.0", false},
+		{"yarn", "latest", "1.22.22", false},
+		{"yarn", "canary", "4.6.0-rc.1", false},
+		{"yarn", "^1", "1.22.22", false},
+		{"yarn", ">=3", "4.5.0", false},
+	}
+
+	for _, tt := range tests {
+		conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), ResolveTTL: time.Hour}
+		got, err := Resolve(conf, inspector.PackageManagerSpec{Name: tt.name, Version: tt.version})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Resolve(%s@%s) error = %v, wantErr %v", tt.name, tt.version, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.Version != tt.expected {
+			t.Errorf("Resolve(%s@%s) = %s, want %s", tt.name, tt.version, got.Version, tt.expected)
+		}
+	}
+}
+
+func TestResolve_Exact(t *testing.T) {
+	conf := &config.Config{Registry: "http://127.0.0.1:0", PmmDir: t.TempDir()}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "9.0.0", HashAlgorithm: "sha512", Hash: "abcd"}
+
+	got, err := Resolve(conf, spec)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if *got != spec {
+		t.Errorf("expected exact spec to be returned unchanged, got %v", got)
+	}
+}
+
+func TestResolve_Cached(t *testing.T) {
+	server, requests := newRegistryServer(t)
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), ResolveTTL: time.Hour}
+	spec := inspector.PackageManagerSpec{Name: "pnpm", Version: "^9"}
+
+	for i := 0; i < 2; i++ {
+		got, err := Resolve(conf, spec)
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if got.Version != "9.12.0" {
+			t.Errorf("expected 9.12.0, got %s", got.Version)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the second resolution to come from cache, got %d requests", n)
+	}
+
+	conf.ResolveTTL = 0
+	if _, err := Resolve(conf, spec); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected expired cache to be revalidated, got %d requests", n)
+	}
+}
+
+func TestResolve_RevalidatesMissingTag(t *testing.T) {
+	var tagged atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tags := map[string]string{"latest": "9.12.0"}
+		if tagged.Load() {
+			tags["next-10"] = "10.0.0-rc.1"
+		}
+		json.NewEncoder(w).Encode(packument(tags, "9.12.0", "10.0.0-rc.1"))
+	}))
+	defer server.Close()
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), MetadataTTL: time.Hour}
+
+	if _, err := Resolve(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "latest"}); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	tagged.Store(true)
+
+	// The packument cached a moment ago is fresh but predates the tag.
+	got, err := Resolve(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "next-10"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got.Version != "10.0.0-rc.1" {
+		t.Errorf("expected 10.0.0-rc.1, got %s", got.Version)
+	}
+}
+
+func TestResolve_Offline(t *testing.T) {
+	server, requests := newRegistryServer(t)
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir(), ResolveTTL: time.Hour, Offline: true}
+	installertest.FakeInstall(t, conf, "pnpm", "8.15.8")
+	installertest.FakeInstall(t, conf, "pnpm", "9.0.0")
+
+	spec, err := Resolve(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "^8 || ^9"})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if spec.Version != "9.0.0" {
+		t.Errorf("expected newest installed 9.0.0, got %s", spec.Version)
+	}
+
+	_, err = Resolve(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "^10"})
+	var offlineErr *installer.OfflineError
+	if !errors.As(err, &offlineErr) || !strings.Contains(err.Error(), "8.15.8, 9.0.0") {
+		t.Errorf("expected OfflineError listing installed versions, got %v", err)
+	}
+
+	if _, err := Resolve(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: "latest"}); !errors.As(err, &offlineErr) {
+		t.Errorf("expected OfflineError for uncached dist-tag, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no registry requests offline, got %d", n)
+	}
+}
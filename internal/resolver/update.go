@@ -0,0 +1,196 @@
+package resolver
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+// The largest kind of release FindUpdate may move to. WithinMinor keeps the
+// current major, WithinPatch the current major.minor.
+const (
+	WithinMajor = "major"
+	WithinMinor = "minor"
+	WithinPatch = "patch"
+)
+
+// SkippedVersion is a newer release that FindUpdate passed over.
+type SkippedVersion struct {
+	Version string
+	Reason  string
+}
+
+// FindUpdate returns the newest stable release of current's package manager,
+// up to its latest dist-tag, that is newer than current (or within current's
+// range), stays within the given level, fits the project's engines and is
+// older than conf.MinReleaseAge. It returns nil when there is none. The newer releases
+// it rejected are returned too, newest first.
+func FindUpdate(conf *config.Config, current inspector.PackageManagerSpec, within string, engines map[string]string) (*inspector.PackageManagerSpec, []SkippedVersion, error) {
+	switch within {
+	case WithinMajor, WithinMinor, WithinPatch:
+	default:
+		return nil, nil, fmt.Errorf("invalid update level %q: expected major, minor or patch", within)
+	}
+
+	// A dist-tag updates from the release it points to now.
+	if !IsExact(current.Version) {
+		if _, err := semver.NewConstraint(current.Version); err != nil {
+			resolved, err := Resolve(conf, current)
+			if err != nil {
+				return nil, nil, err
+			}
+			current = *resolved
+		}
+	}
+
+	// A range stays within itself, and the --within level is measured from
+	// its lower bound. That bound also tells Yarn Berry from Yarn Classic.
+	var floor, bound *semver.Version
+	var rng *semver.Constraints
+	published := current
+	if IsExact(current.Version) {
+		floor = semver.MustParse(current.Version)
+		bound = floor
+	} else {
+		rng, _ = semver.NewConstraint(current.Version)
+		if v, ok := lowestVersion(current.Version); ok {
+			bound = semver.MustParse(v)
+			published.Version = v
+		} else if within != WithinMajor {
+			return nil, nil, fmt.Errorf("updating within a %s needs a current version with a lower bound, not %s", within, current)
+		}
+	}
+
+	pkgName := registry.PackageName(published)
+	getPackument := registry.GetPackument
+	if conf.MinReleaseAge > 0 {
+		getPackument = registry.GetFullPackument
+	}
+	packument, err := getPackument(conf, pkgName)
+	if err != nil {
+		return nil, nil, err
+	}
+	latestTag, ok := packument.DistTags["latest"]
+	if !ok {
+		return nil, nil, fmt.Errorf("latest dist-tag not found for %s", pkgName)
+	}
+	latest, err := semver.NewVersion(latestTag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid latest version %s for %s: %w", latestTag, pkgName, err)
+	}
+
+	var candidates []*semver.Version
+	for v := range packument.Versions {
+		version, err := semver.StrictNewVersion(v)
+		if err != nil || version.Prerelease() != "" || version.GreaterThan(latest) {
+			continue
+		}
+		if floor != nil && !version.GreaterThan(floor) {
+			continue
+		}
+		if rng != nil && !rng.Check(version) {
+			continue
+		}
+		if bound != nil {
+			if within != WithinMajor && version.Major() != bound.Major() {
+				continue
+			}
+			if within == WithinPatch && version.Minor() != bound.Minor() {
+				continue
+			}
+		}
+		candidates = append(candidates, version)
+	}
+	slices.SortFunc(candidates, func(a, b *semver.Version) int { return b.Compare(a) })
+
+	now := time.Now()
+	var skipped []SkippedVersion
+	for _, version := range candidates {
+		v := version.Original()
+		if conf.MinReleaseAge > 0 {
+			if reason := tooNew(conf, packument, v, now); reason != "" {
+				skipped = append(skipped, SkippedVersion{Version: v, Reason: reason})
+				continue
+			}
+		}
+		reason, err := engineConflict(current.Name, v, packument.Versions[v].Engines, engines)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason == "" {
+			return &inspector.PackageManagerSpec{Name: current.Name, Version: v}, skipped, nil
+		}
+		skipped = append(skipped, SkippedVersion{Version: v, Reason: reason})
+	}
+	return nil, skipped, nil
+}
+
+// engineConflict explains why version of the package manager name doesn't
+// fit the project's engines, or returns "" if it does. required is the
+// release's own engines field.
+func engineConflict(name, version string, required, project map[string]string) (string, error) {
+	if rng := project[name]; rng != "" {
+		ok, err := Satisfies(version, rng)
+		if err != nil {
+			return "", fmt.Errorf("invalid engines.%s in package.json: %w", name, err)
+		}
+		if !ok {
+			return fmt.Sprintf("outside engines.%s %q", name, rng), nil
+		}
+	}
+
+	projectNode, requiredNode := project["node"], required["node"]
+	if projectNode == "" || requiredNode == "" {
+		return "", nil
+	}
+	oldest, ok := lowestVersion(projectNode)
+	if !ok {
+		return "", nil
+	}
+	// A release whose own engines.node we can't parse gets the benefit of
+	// the doubt.
+	if ok, err := Satisfies(oldest, requiredNode); err == nil && !ok {
+		return fmt.Sprintf("requires node %q, but engines.node allows %q", requiredNode, projectNode), nil
+	}
+	return "", nil
+}
+
+var versionLiteral = regexp.MustCompile(`\d+(\.\d+){0,2}`)
+
+// lowestVersion finds the oldest version rng admits, out of the versions it
+// names and every x.0.0. That is exact for the lower bounds engines fields
+// use (">=18.12", "^18.17.0 || >=20"). Ranges without a lower bound report
+// false.
+func lowestVersion(rng string) (string, bool) {
+	constraint, err := semver.NewConstraint(rng)
+	if err != nil {
+		return "", false
+	}
+
+	var candidates []*semver.Version
+	for _, literal := range versionLiteral.FindAllString(rng, -1) {
+		if v, err := semver.NewVersion(literal); err == nil {
+			candidates = append(candidates, v)
+		}
+	}
+	for major := range 100 {
+		candidates = append(candidates, semver.New(uint64(major), 0, 0, "", ""))
+	}
+
+	var lowest *semver.Version
+	for _, v := range candidates {
+		if constraint.Check(v) && (lowest == nil || v.LessThan(lowest)) {
+			lowest = v
+		}
+	}
+	if lowest == nil || lowest.Equal(semver.New(0, 0, 0, "", "")) {
+		return "", false
+	}
+	return lowest.String(), true
+}
@@ -0,0 +1,167 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ehyland/pmm2/internal/config"
+	"github.com/ehyland/pmm2/internal/inspector"
+	"github.com/ehyland/pmm2/internal/installer/installertest"
+	"github.com/ehyland/pmm2/internal/registry"
+)
+
+func TestFindUpdate(t *testing.T) {
+	server, _ := newRegistryServer(t)
+	conf := &config.Config{Registry: server.URL}
+
+	tests := []struct {
+		current  string
+		within   string
+		expected string
+		wantErr  bool
+	}{
+		{"8.15.8", WithinMajor, "9.12.0", false},
+		{"8.15.8", WithinMinor, "8.15.9", false},
+		{"8.15.8", WithinPatch, "8.15.9", false},
+		{"9.0.0", WithinPatch, "", false},
+		{"9.12.0", WithinMajor, "", false},
+		{"^8", WithinMajor, "8.15.9", false},
+		{"^8", WithinMinor, "8.15.9", false},
+		{"<9", WithinMinor, "", true},
+		{"8.15.8", "feature", "", true},
+	}
+
+	for _, tt := range tests {
+		target, _, err := FindUpdate(conf, inspector.PackageManagerSpec{Name: "pnpm", Version: tt.current}, tt.within, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FindUpdate(%s, %s) error = %v, wantErr %v", tt.current, tt.within, err, tt.wantErr)
+			continue
+		}
+		var got string
+		if target != nil {
+			got = target.Version
+		}
+		if got != tt.expected {
+			t.Errorf("FindUpdate(%s, %s) = %q, want %q", tt.current, tt.within, got, tt.expected)
+		}
+	}
+}
+
+func TestFindUpdate_Range(t *testing.T) {
+	server := installertest.NewRegistry(t, map[string]installertest.Package{
+		"pnpm":                {DistTags: map[string]string{"latest": "10.2.0"}, Versions: []string{"9.0.0", "9.12.0", "10.2.0"}},
+		"yarn":                {DistTags: map[string]string{"latest": "1.22.22"}, Versions: []string{"1.22.19", "1.22.22"}},
+		registry.BerryPackage: {DistTags: map[string]string{"latest": "4.5.0"}, Versions: []string{"3.8.7", "4.5.0"}},
+	})
+	conf := &config.Config{Registry: server.URL, PmmDir: t.TempDir()}
+
+	tests := []struct {
+		current  string
+		within   string
+		expected string
+	}{
+		{"pnpm@^9", WithinMajor, "9.12.0"},
+		{"pnpm@~9.0.0", WithinMajor, "9.0.0"},
+		{"pnpm@>=9", WithinMajor, "10.2.0"},
+		{"pnpm@>=9", WithinMinor, "9.12.0"},
+		{"yarn@^4", WithinMajor, "4.5.0"},
+		{"yarn@^3", WithinMajor, "3.8.7"},
+		{"yarn@^1", WithinMajor, "1.22.22"},
+		// A dist-tag updates from the release it points to.
+		{"yarn@stable", WithinMajor, ""},
+		{"pnpm@latest", WithinMajor, ""},
+	}
+
+	for _, tt := range tests {
+		current, err := inspector.ParseSpecString(tt.current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, _, err := FindUpdate(conf, current, tt.within, nil)
+		if err != nil {
+			t.Errorf("FindUpdate(%s, %s) error = %v", tt.current, tt.within, err)
+			continue
+		}
+		var got string
+		if target != nil {
+			got = target.Version
+		}
+		if got != tt.expected {
+			t.Errorf("FindUpdate(%s, %s) = %q, want %q", tt.current, tt.within, got, tt.expected)
+		}
+	}
+}
+
+func TestFindUpdate_Engines(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(registry.Packument{
+			DistTags: map[string]string{"latest": "9.12.0"},
+			Versions: map[string]registry.PackumentVersion{
+				"8.15.8": {Engines: map[string]string{"node": ">=16"}},
+				"8.15.9": {Engines: map[string]string{"node": ">=16"}},
+				"9.0.0":  {Engines: map[string]string{"node": ">=18.12"}},
+				"9.12.0": {Engines: map[string]string{"node": ">=18.12"}},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	conf := &config.Config{Registry: server.URL}
+	current := inspector.PackageManagerSpec{Name: "pnpm", Version: "8.15.8"}
+
+	tests := []struct {
+		engines  map[string]string
+		expected string
+		skipped  int
+	}{
+		{nil, "9.12.0", 0},
+		{map[string]string{"node": ">=16"}, "8.15.9", 2},
+		{map[string]string{"node": "^18.17.0 || >=20"}, "9.12.0", 0},
+		{map[string]string{"node": "*"}, "9.12.0", 0},
+		{map[string]string{"pnpm": "<9"}, "8.15.9", 2},
+		{map[string]string{"node": ">=14", "pnpm": "^8"}, "", 3},
+	}
+
+	for _, tt := range tests {
+		target, skipped, err := FindUpdate(conf, current, WithinMajor, tt.engines)
+		if err != nil {
+			t.Errorf("FindUpdate(%v) error = %v", tt.engines, err)
+			continue
+		}
+		var got string
+		if target != nil {
+			got = target.Version
+		}
+		if got != tt.expected || len(skipped) != tt.skipped {
+			t.Errorf("FindUpdate(%v) = %q skipping %v, want %q skipping %d", tt.engines, got, skipped, tt.expected, tt.skipped)
+		}
+	}
+
+	if _, _, err := FindUpdate(conf, current, WithinMajor, map[string]string{"pnpm": "bogus"}); err == nil {
+		t.Error("expected an invalid engines range to be an error")
+	}
+}
+
+func TestLowestVersion(t *testing.T) {
+	tests := []struct {
+		rng      string
+		expected string
+		ok       bool
+	}{
+		{">=18.12", "18.12.0", true},
+		{"^18.17.0 || >=20.5.0", "18.17.0", true},
+		{"18.x", "18.0.0", true},
+		{">16", "17.0.0", true},
+		{"*", "", false},
+		{"<20", "", false},
+		{"bogus", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := lowestVersion(tt.rng)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("lowestVersion(%s) = %q, %v, want %q, %v", tt.rng, got, ok, tt.expected, tt.ok)
+		}
+	}
+}